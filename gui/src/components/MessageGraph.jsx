@@ -258,12 +258,12 @@ const MessageGraph = ({
 					)}
 
 					{rankOrder &&
-						rankOrder.map(({ rank, nodeId }, idx) => {
+						rankOrder.map(({ rank }, idx) => {
 							const { x, y } = getNodeCoordinates(idx, 0);
 							return (
 								<Text
 									key={rank}
-									text={`Rank: ${rank}\n Id:${nodeId}`}
+									text={`Rank: ${rank}`}
 									x={x}
 									y={y}
 									fontSize={13}
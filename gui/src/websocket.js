@@ -1,4 +1,4 @@
-const SERVER_URL = 'ws://127.0.0.1:3496';
+const SERVER_URL = `ws://127.0.0.1:${WS_PORT}`;
 let socket;
 
 export const connect = (onMessage) => {
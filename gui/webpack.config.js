@@ -1,4 +1,5 @@
 const path = require('path');
+const webpack = require('webpack');
 
 module.exports = function (_env, argv) {
 	const isProduction = argv.mode === 'production';
@@ -35,6 +36,12 @@ module.exports = function (_env, argv) {
 		resolve: {
 			extensions: ['.js', '.jsx'],
 		},
+		plugins: [
+			// port of the orchestrator websocket server, set by the orchestrator when starting the gui
+			new webpack.DefinePlugin({
+				WS_PORT: JSON.stringify(process.env.WS_PORT || '3496'),
+			}),
+		],
 		devServer: {
 			setupExitSignals: true,
 		},
@@ -57,6 +57,23 @@ func SetMaxLogLevel(level LoggingLevel) {
 	maxLogLevel = level
 }
 
+// Returns the logging level matching the name (error, warn, info, verbose, debug)
+func ParseLevel(name string) (LoggingLevel, error) {
+	level, ok := map[string]LoggingLevel{
+		"error":   err,
+		"warn":    warn,
+		"info":    info,
+		"verbose": verbose,
+		"debug":   debug,
+	}[name]
+
+	if !ok {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+
+	return level, nil
+}
+
 func Error(str string, args ...interface{}) {
 	log(err, str, args...)
 }
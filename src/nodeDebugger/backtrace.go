@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/rpc"
+)
+
+// Reports the call stack with the parameters of each frame to the orchestrator, which prints it
+func reportStackTrace(ctx *processContext) {
+	report := rpc.NodeBacktrace{NodeId: ctx.nodeData.id, Selected: ctx.selectedFrame}
+
+	for index := range ctx.stack {
+		report.Frames = append(report.Frames, describeFrame(ctx, index))
+	}
+
+	reportBacktrace(ctx, &report)
+}
+
+// Selects the frame of the call stack variables are printed in, counting from the innermost one
+func selectFrame(ctx *processContext, index int) error {
+	if ctx.stack.frame(index) == nil {
+		return fmt.Errorf("no frame %d, the call stack has %d frames", index, len(ctx.stack))
+	}
+
+	ctx.selectedFrame = index
+	logger.Info("#%d  %v", index, describeFrame(ctx, index))
+
+	return nil
+}
+
+// Returns the function, line and parameter values of the frame at the index of the call stack
+func describeFrame(ctx *processContext, index int) rpc.StackFrame {
+	frame := ctx.stack[index]
+
+	if frame.function == nil {
+		// the location and parameters of code without debug information are unknown
+		return rpc.StackFrame{Function: frame.name(), Parameters: []string{}}
+	}
+
+	pc := frame.pc
+	if index > 0 {
+		// callers are at the line of the call, which ends before the return address
+		pc--
+	}
+	line, file := ctx.dwarfData.LineContaining(pc)
+
+	description := rpc.StackFrame{
+		Function:   frame.function.Name(),
+		File:       filepath.Base(file),
+		Line:       line,
+		Parameters: []string{},
+	}
+
+	for _, parameter := range frame.function.Parameters {
+		variable := parameter.AsVariable()
+
+		value := interface{}("?")
+		if address, err := variableAddress(variable, frame); err == nil && address != 0 {
+			if data, err := peekDataFromMemory(ctx, address, variable.ByteSize()); err == nil {
+				value = convertValueToType(data, variable)
+			}
+		}
+
+		description.Parameters = append(description.Parameters, fmt.Sprintf("%v=%v", parameter.Name, value))
+	}
+
+	return description
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/mihkeltiks/rev-mpi-deb/logger"
 	"github.com/mihkeltiks/rev-mpi-deb/nodeDebugger/dwarf"
+	"github.com/mihkeltiks/rev-mpi-deb/rpc"
 	"github.com/mihkeltiks/rev-mpi-deb/utils"
 	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
 )
@@ -21,6 +23,15 @@ type bpointData struct {
 	isImmediateAfterRestore bool
 	ignoreFirstHit          bool
 	line                    int
+	file                    string
+	functionName            string          // set for breakpoints at the entry of a function
+	condition               string          // the breakpoint is only reported when the condition holds
+	id                      int             // number in the breakpoint table of the orchestrator
+	temporary               bool            // removed after the first stop
+	ignoreCount             int             // remaining hits to pass before stopping
+	returnFrame             uint64          // for breakpoints at a return address, the frame awaited to return
+	finishing               *dwarf.Function // for the breakpoint set by finish, the function awaited to return
+	watchScope              *watchpointData // for the breakpoint at the return address of the frame of a watched local, its watchpoint
 }
 
 func (b *bpointData) String() string {
@@ -30,10 +41,79 @@ func (b *bpointData) String() string {
 	return fmt.Sprintf("{address: %#x}", b.address)
 }
 
+// Returns the breakpoint as set by the user, at the given line.
+// A negative line reinserts it ignoring the first hit
+func (b *bpointData) spec(line int) command.Breakpoint {
+	return command.Breakpoint{
+		Line:      line,
+		File:      b.file,
+		Function:  b.functionName,
+		Condition: b.condition,
+
+		Id:          b.id,
+		Temporary:   b.temporary,
+		IgnoreCount: b.ignoreCount,
+	}
+}
+
+// Finds the address for a breakpoint at a line, file:line or function entry.
+// Locations matching several places in the target are reported as ambiguous
+func resolveBreakpointLocation(ctx *processContext, breakpoint command.Breakpoint) (location dwarf.Location, err error) {
+	var locations []dwarf.Location
+
+	if breakpoint.Function != "" {
+		locations = ctx.dwarfData.FunctionLocations(breakpoint.Function)
+
+		if len(locations) == 0 {
+			return location, fmt.Errorf("function %v not found", breakpoint.Function)
+		}
+	} else {
+		file := ctx.sourceFile
+
+		if breakpoint.File != "" {
+			files := ctx.dwarfData.MatchFiles(breakpoint.File)
+
+			if len(files) == 0 {
+				return location, fmt.Errorf("no source file matches %v", breakpoint.File)
+			}
+			if len(files) > 1 {
+				return location, fmt.Errorf("ambiguous location, %v matches files: %v", breakpoint.File, strings.Join(files, ", "))
+			}
+			file = files[0]
+		}
+
+		locations = ctx.dwarfData.LineLocations(file, breakpoint.Line)
+
+		if len(locations) == 0 {
+			return location, fmt.Errorf("unable to find suitable instruction for line %d in file %s", breakpoint.Line, file)
+		}
+	}
+
+	if len(locations) > 1 {
+		descriptions := make([]string, len(locations))
+		for index, location := range locations {
+			descriptions[index] = location.String()
+		}
+		return location, fmt.Errorf("ambiguous location %v: %v", breakpoint.Location(), strings.Join(descriptions, ", "))
+	}
+
+	return locations[0], nil
+}
+
 func (b breakpointData) New() breakpointData {
 	return make(map[uint64]*bpointData)
 }
 
+func findBreakpointById(ctx *processContext, id int) *bpointData {
+	for _, bPoint := range ctx.bpointData {
+		if !bPoint.isMPIBpoint && bPoint.id == id {
+			return bPoint
+		}
+	}
+
+	return nil
+}
+
 func findBreakpointByAddress(ctx *processContext, address uint64) *bpointData {
 	for bPointAddress, bPoint := range ctx.bpointData {
 		if bPointAddress == address {
@@ -71,8 +151,9 @@ func getOriginalInstruction(ctx *processContext, address uint64) (originalInstru
 	return originalInstruction
 }
 
-// restores the original instruction if the executable is currently caught at a breakpoint
-func restoreCaughtBreakpoint(ctx *processContext) (caugtBpoint *bpointData, registers *syscall.PtraceRegs, line int) {
+// restores the original instruction if the executable is currently caught at a breakpoint.
+// Reports whether the target should stop there: the condition holds and no more hits are to be ignored
+func restoreCaughtBreakpoint(ctx *processContext) (caugtBpoint *bpointData, registers *syscall.PtraceRegs, line int, stop bool) {
 	file := ""
 	regs := getRegs(ctx, true)
 	line = 0
@@ -84,16 +165,7 @@ func restoreCaughtBreakpoint(ctx *processContext) (caugtBpoint *bpointData, regi
 
 	if bpoint == nil {
 		logger.Debug("Cannot find a breakpoint to restore")
-		return nil, nil, 0
-	}
-
-	if bpoint.isMPIBpoint {
-		logger.Debug("Caught auto-inserted MPI breakpoint, func: %v", bpoint.function.Name())
-	} else {
-		line, file, _, _ = ctx.dwarfData.PCToLine(regs.Rip)
-		cmd := command.Command{NodeId: ctx.nodeData.id, Code: command.CommandCode(line)}
-		logger.Info("Caught at a breakpoint: line: %d, file: %v", line, filepath.Base(file))
-		reportBreakpoint(ctx, &cmd)
+		return nil, nil, 0, false
 	}
 
 	// replace the break instruction with the original instruction
@@ -107,5 +179,54 @@ func restoreCaughtBreakpoint(ctx *processContext) (caugtBpoint *bpointData, regi
 	// remove record of breakpoint
 	delete(ctx.bpointData, bpoint.address)
 
-	return bpoint, regs, line
+	if bpoint.isMPIBpoint {
+		logger.Debug("Caught auto-inserted MPI breakpoint, func: %v", bpoint.function.Name())
+		return bpoint, regs, line, false
+	}
+
+	line, file, _, _ = ctx.dwarfData.PCToLine(regs.Rip)
+
+	switch {
+	case bpoint.returnFrame != 0:
+		if returnedFromFrame(bpoint, regs) {
+			stop = true
+			if bpoint.finishing != nil {
+				reportFinish(ctx, bpoint, regs)
+			}
+			if bpoint.watchScope != nil {
+				leaveWatchpointScope(ctx, bpoint.watchScope)
+			}
+		}
+	case bpoint.ignoreFirstHit:
+		// the target was already stopped here
+	case !conditionHolds(ctx, bpoint.condition):
+		logger.Debug("condition %v of breakpoint at line %d does not hold", bpoint.condition, line)
+	case bpoint.ignoreCount > 0:
+		bpoint.ignoreCount--
+		logger.Debug("ignoring hit of breakpoint at line %d, %d more to ignore", line, bpoint.ignoreCount)
+		reportBreakpointHit(ctx, bpoint.id, true)
+	default:
+		stop = true
+		logger.Info("Caught at a breakpoint: line: %d, file: %v", line, filepath.Base(file))
+		reportBreakpointHit(ctx, bpoint.id, false)
+		reportBreakpoint(ctx, rpc.BreakpointStop{NodeId: ctx.nodeData.id, BreakpointId: bpoint.id})
+	}
+
+	return bpoint, regs, line, stop
+}
+
+// Executes the original instruction at a breakpoint the target is caught at, leaving the breakpoint in place
+func stepOverBreakpoint(ctx *processContext, bpoint *bpointData) {
+	regs := getRegs(ctx, true)
+
+	_, err := syscall.PtracePokeData(ctx.pid, uintptr(bpoint.address), bpoint.originalInstruction)
+	utils.Must(err)
+
+	err = syscall.PtraceSetRegs(ctx.pid, regs)
+	utils.Must(err)
+
+	continueExecution(ctx, true, false, false)
+
+	insertBreakpoint(ctx, bpoint.address)
+	bpoint.ignoreFirstHit = false
 }
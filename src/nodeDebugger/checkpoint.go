@@ -77,6 +77,13 @@ func createCheckpoint(ctx *processContext, opName string) string {
 			function:                bp.function,
 			isMPIBpoint:             bp.isMPIBpoint,
 			isImmediateAfterRestore: false,
+			line:                    bp.line,
+			file:                    bp.file,
+			functionName:            bp.functionName,
+			condition:               bp.condition,
+			id:                      bp.id,
+			temporary:               bp.temporary,
+			ignoreCount:             bp.ignoreCount,
 		}
 	}
 
@@ -164,7 +171,7 @@ func createCRIUCheckpoint(ctx *processContext, opName string) cPoint {
 	logger.Debug("Executing CRIU checkpoint on: %v", ctx.pid)
 	c := criu.MakeCriu()
 
-	checkpointDir, err := os.MkdirTemp(fmt.Sprintf("%v/temp", utils.GetExecutableDir()), fmt.Sprintf("%s-cp-*", filepath.Base(ctx.targetFile)))
+	checkpointDir, err := os.MkdirTemp(ctx.tempDir, fmt.Sprintf("%s-cp-*", filepath.Base(ctx.targetFile)))
 	if err != nil {
 		logger.Error("Error creating folder, %v", err)
 	}
@@ -193,7 +200,7 @@ func createCRIUCheckpoint(ctx *processContext, opName string) cPoint {
 func createFileCheckpoint(ctx *processContext, opName string) cPoint {
 	regs := getRegs(ctx, false)
 
-	checkpointFile, err := os.CreateTemp(fmt.Sprintf("%v/temp", utils.GetExecutableDir()), fmt.Sprintf("%v-cp-*", filepath.Base(ctx.targetFile)))
+	checkpointFile, err := os.CreateTemp(ctx.tempDir, fmt.Sprintf("%v-cp-*", filepath.Base(ctx.targetFile)))
 
 	regions := proc.GetFileCheckpointDataAddresses(ctx.pid, ctx.targetFile)
 
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"errors"
+	"flag"
 	"fmt"
 	"net/url"
 	"os"
@@ -54,6 +55,9 @@ func printInstructions() {
 	fmt.Print("\nAvailable commands:\n\n")
 
 	fmt.Println("  b <lineNr> \t set breakpoint")
+	fmt.Println("  b <file:lineNr> \t set breakpoint in a source file")
+	fmt.Println("  b <function> \t set breakpoint at the entry of a function")
+	fmt.Println("  b <lineNr> if <cond> \t set breakpoint, stopping only when the condition holds")
 	fmt.Println("  s  \t\t single-step forward")
 	fmt.Println("  c  \t\t continue execution")
 	fmt.Println("  r <cp index> \t restore checkpoint")
@@ -64,20 +68,32 @@ func printInstructions() {
 }
 
 // parse and validate command line arguments
-func getValuesFromArgs() (targetFilePath string, checkpointMode CheckpointMode, orchestratorAddress *url.URL, isStandaloneMode bool) {
+func getValuesFromArgs() (targetFilePath string, launchData targetLaunchData, checkpointMode CheckpointMode, orchestratorAddress *url.URL, isStandaloneMode bool, portBase int, tempDir string) {
 
-	if len(os.Args) < 3 {
+	flags := flag.NewFlagSet("node-debugger", flag.ExitOnError)
+	flags.Usage = printUsage
+
+	var targetEnv utils.ListFlag
+	flags.Var(&targetEnv, "env", "environment variable (KEY=VALUE) of the target, can be repeated")
+	flags.StringVar(&launchData.stdin, "stdin", "", "file to redirect to the standard input of the target, %r is replaced with the rank")
+	flags.IntVar(&portBase, "port-base", 3500, "the rpc server listens on port-base + rank, 0 selects a free port")
+	flags.StringVar(&tempDir, "temp-dir", fmt.Sprintf("%v/temp", utils.GetExecutableDir()), "directory for checkpoint files")
+
+	flags.Parse(os.Args[1:])
+	args := flags.Args()
+
+	if len(args) < 2 {
 		printUsage()
 	}
 
 	var err error
 
-	switch os.Args[1] {
+	switch args[0] {
 	case "hello":
 		logger.Info("loading example mpi hello binary")
 		targetFilePath, err = filepath.Abs("bin/targets/hello")
 	default:
-		targetFilePath, err = filepath.Abs(os.Args[1])
+		targetFilePath, err = filepath.Abs(args[0])
 	}
 
 	utils.Must(err)
@@ -99,10 +115,10 @@ func getValuesFromArgs() (targetFilePath string, checkpointMode CheckpointMode,
 	// 	logger.Info("Checkpoint mode: file")
 	// }
 
-	if os.Args[2] == "cli" {
+	if args[1] == "cli" {
 		isStandaloneMode = true
 	} else {
-		orchestratorAddress, err = url.ParseRequestURI(os.Args[2])
+		orchestratorAddress, err = url.ParseRequestURI(args[1])
 
 		if err != nil {
 			os.Stderr.WriteString(err.Error())
@@ -110,19 +126,36 @@ func getValuesFromArgs() (targetFilePath string, checkpointMode CheckpointMode,
 		}
 	}
 
-	return targetFilePath, fileMode, orchestratorAddress, isStandaloneMode
+	for _, variable := range targetEnv {
+		if !strings.Contains(variable, "=") {
+			fmt.Printf("invalid environment variable %q, expected KEY=VALUE\n", variable)
+			printUsage()
+		}
+	}
+
+	// remaining arguments are passed on to the target
+	launchData.args = args[2:]
+	launchData.env = targetEnv
+
+	return targetFilePath, launchData, fileMode, orchestratorAddress, isStandaloneMode, portBase, tempDir
 }
 
 func printUsage() {
 	fmt.Println("Usage:")
-	fmt.Println("cli mode: node-debugger <target binary> cli")
-	fmt.Println("network mode: node-debugger <target binary> <orchestrator address>")
+	fmt.Println("cli mode: node-debugger [options] <target binary> cli [target args]")
+	fmt.Println("network mode: node-debugger [options] <target binary> <orchestrator address> [target args]")
+	fmt.Println()
+	fmt.Println("options:")
+	fmt.Println("  -env <KEY=VALUE>    environment variable of the target, can be repeated")
+	fmt.Println("  -stdin <file>       file redirected to the stdin of the target, %r is replaced with the rank")
+	fmt.Println("  -port-base <port>   the rpc server listens on port-base + rank, 0 selects a free port (default 3500)")
+	fmt.Println("  -temp-dir <dir>     directory for checkpoint files")
 	os.Exit(2)
 }
 
 func parseCommandFromString(input string) (c *command.Command) {
 
-	breakPointRegexp := regexp.MustCompile(`^b \d+$`)
+	breakPointRegexp := regexp.MustCompile(`^b .+$`)
 	printRegexp := regexp.MustCompile(`^p [a-zA-Z_][a-zA-Z0-9_]*$`)
 	printInternalRegexp := regexp.MustCompile(`^pd [a-zA-Z_][a-zA-Z0-9_]*$`)
 
@@ -130,9 +163,13 @@ func parseCommandFromString(input string) (c *command.Command) {
 
 	switch {
 	case breakPointRegexp.Match([]byte(input)):
-		lineNr, _ := strconv.Atoi(strings.Split(input, " ")[1])
+		breakpoint, err := command.ParseBreakpoint(input[2:])
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
 
-		return &command.Command{Code: command.Bpoint, Argument: lineNr}
+		return &command.Command{Code: command.Bpoint, Argument: breakpoint}
 
 	case input == "c":
 		return &command.Command{Code: command.Cont, Argument: nil}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/expression"
+)
+
+// Evaluates the condition of the breakpoint or watchpoint the target is stopped at, empty conditions hold.
+// A condition that cannot be evaluated counts as holding, so the user gets to see the problem
+func conditionHolds(ctx *processContext, source string) bool {
+	if source == "" {
+		return true
+	}
+
+	condition, err := expression.Parse(source)
+	if err != nil {
+		logger.Warn("invalid breakpoint condition %v: %v", source, err)
+		return true
+	}
+
+	ctx.stack = getStack(ctx)
+
+	value, err := evaluateNumber(ctx, condition)
+	if err != nil {
+		logger.Warn("cannot evaluate breakpoint condition %v: %v", source, err)
+		return true
+	}
+
+	return !value.isZero()
+}
@@ -1,19 +1,27 @@
 package main
 
 import (
+	"fmt"
 	"io"
+	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/mihkeltiks/rev-mpi-deb/logger"
 	"github.com/mihkeltiks/rev-mpi-deb/nodeDebugger/dwarf"
 	"github.com/mihkeltiks/rev-mpi-deb/rpc"
+	"github.com/mihkeltiks/rev-mpi-deb/utils"
 	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/mpi"
 )
 
 const MAIN_FN = "main"
+const COUNTER_FN = "call_counter" // statement counter inserted by the compiler
 
 type processContext struct {
 	targetFile     string           // the executing binary file
@@ -22,15 +30,38 @@ type processContext struct {
 	process        *exec.Cmd        // the running binary
 	pid            int              // the process id of the running binary
 	bpointData     breakpointData   // holds the instuctions for currently replaced by breakpoints
+	watchpoints    watchpointSlots  // hardware watchpoints, by the debug register holding their address
 	cpointData     checkpointData   // holds data about currently recorded checkppoints
 	checkpointMode CheckpointMode   // whether checkpoints are recorded in files or in forked processes
 	stack          programStack     // current call stack of the target. updated after each command execution
+	selectedFrame  int              // index of the frame of the call stack variables are printed in
+	displays       []display        // expressions printed each time the target stops
 	nodeData       *nodeData        // data about connection with the orchestrator
+	interruption   interruption     // request of the orchestrator served while a command runs the target
+	interrupted    bool             // the running command ended where the orchestrator stopped the target
+	tempDir        string           // directory for checkpoint files
+}
+
+type targetLaunchData struct {
+	args  []string // command line arguments of the target
+	env   []string // additional environment variables (KEY=VALUE) of the target
+	stdin string   // file redirected to the standard input of the target, %r is replaced with the rank
 }
 
 type nodeData struct {
-	id        int            // designated by the orchestrator
-	rpcClient *rpc.RPCClient // rpc client for communicating with the orchestrator
+	id                  int            // designated by the orchestrator
+	rpcClient           *rpc.RPCClient // rpc client for communicating with the orchestrator
+	orchestratorAddress *url.URL       // address of the orchestrator rpc server, used for reconnecting
+	port                int            // port of the rpc server of this node
+	rank                int            // MPI_COMM_WORLD rank of the target, -1 until known
+}
+
+// Id shown in the log rows of this node: the rank, or the node id while the rank is unknown
+func (n *nodeData) logId() int {
+	if n.rank < 0 {
+		return n.id
+	}
+	return n.rank
 }
 
 func main() {
@@ -38,25 +69,35 @@ func main() {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
-	precleanup()
+	targetFile, launchData, checkpointMode, orchestratorAddress, standaloneMode, portBase, tempDir := getValuesFromArgs()
 
-	targetFile, checkpointMode, orchestratorAddress, standaloneMode := getValuesFromArgs()
+	precleanup(tempDir)
 
 	ctx := &processContext{
 		targetFile:     targetFile,
 		checkpointMode: checkpointMode,
 		bpointData:     breakpointData{}.New(),
 		cpointData:     checkpointData{}.New(),
+		tempDir:        tempDir,
 	}
 
+	var listener net.Listener
+
 	if !standaloneMode {
+		// the rpc server must be listening before registering, as its port is reported to the orchestrator
+		listener = rpc.Listen(nodePort(portBase))
+
 		// connect to orchestrator
+		rank, _ := mpi.RankFromEnv()
 		ctx.nodeData = &nodeData{
-			rpcClient: rpc.Connect(orchestratorAddress),
+			rpcClient:           rpc.Connect(orchestratorAddress),
+			orchestratorAddress: orchestratorAddress,
+			port:                rpc.ListenerPort(listener),
+			rank:                rank,
 		}
 
 		ctx.nodeData.id = reportAsHealthy(ctx)
-		logger.SetRemoteClient(ctx.nodeData.rpcClient, ctx.nodeData.id)
+		logger.SetRemoteClient(ctx.nodeData.rpcClient, ctx.nodeData.logId())
 
 		// logger.Info("Process (pid: %d) registered", os.Getpid())
 	}
@@ -67,7 +108,7 @@ func main() {
 	ctx.sourceFile = ctx.dwarfData.FindEntrySourceFile(MAIN_FN)
 
 	// start target binary
-	ctx.process = startBinary(ctx.targetFile)
+	ctx.process = startBinary(ctx.targetFile, launchData)
 	ctx.pid = ctx.process.Process.Pid
 
 	// set up automatic breakpoints
@@ -76,18 +117,33 @@ func main() {
 	if standaloneMode {
 		handleCLIWorkflow(ctx)
 	} else {
-		handleRemoteWorkflow(ctx)
+		handleRemoteWorkflow(ctx, listener)
+	}
+
+}
+
+// Returns the port for the rpc server of the node: the port base offset by the rank of the process.
+// If the port base is 0 or the rank is unknown, a free port is selected
+func nodePort(portBase int) int {
+	if portBase == 0 {
+		return 0
 	}
 
+	rank, ok := mpi.RankFromEnv()
+	if !ok {
+		logger.Warn("rank of the process is unknown, selecting a free rpc port")
+		return 0
+	}
+
+	return portBase + rank
 }
 
-func handleRemoteWorkflow(ctx *processContext) {
+func handleRemoteWorkflow(ctx *processContext, listener net.Listener) {
 	// channel for commands scheduled for execution by orchestrator
 	commandQueue := make(chan *command.Command, 10)
 
 	go func() {
-		port := 3500 + ctx.nodeData.id
-		rpc.InitializeServer(port, func(register rpc.Registrator) {
+		rpc.Serve(listener, func(register rpc.Registrator) {
 			logger.Verbose("Registering debugging methods for remote use")
 
 			register(&RemoteCmdHandler{ctx, commandQueue})
@@ -130,12 +186,19 @@ func (l LoggerWriter) Write(p []byte) (n int, err error) {
 
 var pipe io.ReadCloser
 
-func startBinary(target string) *exec.Cmd {
+func startBinary(target string, launchData targetLaunchData) *exec.Cmd {
 
-	cmd := exec.Command(target)
+	cmd := exec.Command(target, launchData.args...)
 
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), launchData.env...)
+
+	if launchData.stdin != "" {
+		stdin, err := openTargetStdin(launchData.stdin)
+		utils.Must(err)
+		cmd.Stdin = stdin
+	}
 
 	pipe, _ = cmd.StdoutPipe()
 
@@ -155,3 +218,21 @@ func startBinary(target string) *exec.Cmd {
 
 	return cmd
 }
+
+// Opens the file redirected to the standard input of the target.
+// Occurrences of %r in the path are replaced with the rank of the process
+func openTargetStdin(pathTemplate string) (*os.File, error) {
+	path := pathTemplate
+
+	if strings.Contains(pathTemplate, "%r") {
+		rank, ok := mpi.RankFromEnv()
+		if !ok {
+			return nil, fmt.Errorf("cannot expand %v: rank of the process is unknown", pathTemplate)
+		}
+		path = strings.ReplaceAll(pathTemplate, "%r", strconv.Itoa(rank))
+	}
+
+	logger.Debug("redirecting target stdin from %v", path)
+
+	return os.Open(path)
+}
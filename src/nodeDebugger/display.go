@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/expression"
+)
+
+// An expression printed each time the target stops
+type display struct {
+	id     int
+	source string
+}
+
+// Adds an expression to the displays and prints it, or prints all the displays when the source is empty
+func addDisplay(ctx *processContext, source string) error {
+	if source == "" {
+		printDisplays(ctx)
+		return nil
+	}
+
+	if _, err := expression.Parse(source); err != nil {
+		return fmt.Errorf("cannot display %v: %v", source, err)
+	}
+
+	id := 1
+	if len(ctx.displays) > 0 {
+		id = ctx.displays[len(ctx.displays)-1].id + 1
+	}
+
+	ctx.displays = append(ctx.displays, display{id, source})
+	printDisplay(ctx, ctx.displays[len(ctx.displays)-1])
+
+	return nil
+}
+
+// Removes the display with the number, or all of them for 0
+func removeDisplay(ctx *processContext, id int) error {
+	if id == 0 {
+		ctx.displays = nil
+		return nil
+	}
+
+	for index, existing := range ctx.displays {
+		if existing.id == id {
+			ctx.displays = append(ctx.displays[:index], ctx.displays[index+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no display number %d", id)
+}
+
+func printDisplays(ctx *processContext) {
+	for _, existing := range ctx.displays {
+		printDisplay(ctx, existing)
+	}
+}
+
+func printDisplay(ctx *processContext, existing display) {
+	value, err := evaluateSource(ctx, existing.source)
+	if err != nil {
+		logger.Warn("%d: cannot display %v: %v", existing.id, existing.source, err)
+		return
+	}
+
+	formatted, err := formatValue(ctx, value)
+	if err != nil {
+		logger.Warn("%d: cannot display %v: %v", existing.id, existing.source, err)
+		return
+	}
+
+	fmt.Printf("%d: %v = %v\n", existing.id, existing.source, formatted)
+}
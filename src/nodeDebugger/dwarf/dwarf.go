@@ -2,6 +2,8 @@ package dwarf
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"unsafe"
 )
 
@@ -91,6 +93,96 @@ func (d *DwarfData) LineToPC(file string, line int) (address uint64, err error)
 	return 0, fmt.Errorf("unable to find suitable instruction for line %d in file %s", line, file)
 }
 
+// A resolved source location a breakpoint can be inserted at
+type Location struct {
+	Address  uint64
+	File     string
+	Line     int
+	Function *Function
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%v:%d (func %v)", l.File, l.Line, l.Function.Name())
+}
+
+// Returns the source files whose path is name or ends with /name
+func (d *DwarfData) MatchFiles(name string) []string {
+	files := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, module := range d.Modules {
+		for _, file := range module.files {
+			if seen[file] {
+				continue
+			}
+			if file == name || strings.HasSuffix(file, "/"+name) {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files
+}
+
+// Returns the recommended breakpoint location for the line in every module the line has code in.
+// A header file included in several modules can have more than one
+func (d *DwarfData) LineLocations(file string, line int) []Location {
+	locations := make([]Location, 0)
+
+	for _, module := range d.Modules {
+		for _, entry := range module.entries {
+			if entry.line == line && entry.isStmt && module.files[entry.file] == file {
+				locations = append(locations, Location{entry.Address, file, line, d.PCToFunc(entry.Address)})
+				break
+			}
+		}
+	}
+
+	return locations
+}
+
+// Returns the location after the prologue of every function with the given name.
+// Static functions in different modules can share a name
+func (d *DwarfData) FunctionLocations(functionName string) []Location {
+	locations := make([]Location, 0)
+
+	for _, module := range d.Modules {
+		for _, function := range module.functions {
+			if function.name != functionName {
+				continue
+			}
+
+			var functionEntries []Entry
+			for _, entry := range module.entries {
+				if entry.Address >= function.lowPC && entry.Address < function.highPC {
+					functionEntries = append(functionEntries, entry)
+				}
+			}
+			if len(functionEntries) == 0 {
+				continue
+			}
+
+			// without a marked prologue end, break at the second entry, as for mpi functions
+			location := functionEntries[0]
+			if len(functionEntries) > 1 {
+				location = functionEntries[1]
+			}
+			for _, entry := range functionEntries {
+				if entry.prologueEnd {
+					location = entry
+					break
+				}
+			}
+
+			locations = append(locations, Location{location.Address, module.files[location.file], location.line, function})
+		}
+	}
+
+	return locations
+}
+
 func (d *DwarfData) PCToLine(pc uint64) (line int, file string, function *Function, err error) {
 	for _, module := range d.Modules {
 		if pc >= module.startAddress && pc <= module.endAddress {
@@ -106,6 +198,63 @@ func (d *DwarfData) PCToLine(pc uint64) (line int, file string, function *Functi
 	return 0, "", nil, fmt.Errorf("unable to find instruction matching address %v", pc)
 }
 
+// Returns the line of the instruction at pc, which can be in the middle of the line
+func (d *DwarfData) LineContaining(pc uint64) (line int, file string) {
+	for _, module := range d.Modules {
+		if pc >= module.startAddress && pc <= module.endAddress {
+			var closest *Entry
+			for index, entry := range module.entries {
+				if entry.Address <= pc && (closest == nil || entry.Address > closest.Address) {
+					closest = &module.entries[index]
+				}
+			}
+			if closest != nil {
+				return closest.line, module.files[closest.file]
+			}
+		}
+	}
+	return 0, ""
+}
+
+// Whether a statement starts at pc, according to the line table
+func (d *DwarfData) IsStatementStart(pc uint64) bool {
+	for _, module := range d.Modules {
+		if pc >= module.startAddress && pc <= module.endAddress {
+			for _, entry := range module.entries {
+				if entry.Address == pc && entry.isStmt {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Returns the type of the return value of the function, nil for functions returning void
+func (d *DwarfData) ReturnType(function *Function) *Type {
+	if function.returnType == 0 {
+		return nil
+	}
+	return d.Types.resolve(function.returnType)
+}
+
+// Finds a type declared by the target by its name as written in C, like int, point or struct cell.
+// Complete declarations of structs are preferred to those only naming them
+func (d *DwarfData) LookupType(name string) *Type {
+	var found *Type
+
+	for _, dataType := range d.Types {
+		switch dataType.kind {
+		case KindBase, KindStruct, KindUnion, KindEnum, KindTypedef:
+			if dataType.Name() == name && (found == nil || found.ByteSize() == 0) {
+				found = dataType
+			}
+		}
+	}
+
+	return found
+}
+
 func (d *DwarfData) PCToFunc(pc uint64) *Function {
 	// logger.Debug("pc to func %#x", pc)
 	for _, module := range d.Modules {
@@ -15,7 +15,7 @@ type Module struct {
 	Variables    []*Variable    // variables declared in this module
 }
 
-type typeMap map[dwarf.Offset]*BaseType
+type typeMap map[dwarf.Offset]*Type
 
 type Entry struct {
 	// Program-counter value of a machine instruction
@@ -49,24 +49,31 @@ type Function struct {
 	lowPC      uint64       // first PC address for the function
 	highPC     uint64       // last PC address for the function
 	Parameters []*Parameter // function parameters
+	returnType dwarf.Offset // type of the return value, 0 for functions returning void
 }
 
 type Parameter struct {
 	Name                 string
-	baseType             *BaseType            // type of the variable
+	typeOffset           dwarf.Offset         // type of the variable
+	types                typeMap              // the types of the target, resolving the type offset
 	locationInstructions locationInstructions // raw dwarf location instructions
 	function             *Function            // the function the parameter is an argument for
 }
 
-type BaseType struct {
-	name     string
-	byteSize int64
-	encoding int64
-}
+// DWARF base type encodings (DW_ATE_*)
+const (
+	EncodingBoolean      = 0x2
+	EncodingFloat        = 0x4
+	EncodingSigned       = 0x5
+	EncodingSignedChar   = 0x6
+	EncodingUnsigned     = 0x7
+	EncodingUnsignedChar = 0x8
+)
 
 type Variable struct {
 	name                 string               // variable name
-	baseType             *BaseType            // type of the variable
+	typeOffset           dwarf.Offset         // type of the variable
+	types                typeMap              // the types of the target, resolving the type offset
 	locationInstructions locationInstructions // raw dwarf location instructions
 	Function             *Function            // the function where variable is declared (might be nil)
 	isFnParam            bool                 // whether the variable is a function parameter
@@ -103,12 +110,22 @@ func (fn *Function) Name() string {
 	return fn.name
 }
 
+// The address of the first instruction of the function
+func (fn *Function) LowPC() uint64 {
+	return fn.lowPC
+}
+
+// Whether the function returns a value, as opposed to void
+func (fn *Function) ReturnsValue() bool {
+	return fn.returnType != 0
+}
+
 func (e Entry) String() string {
 	return fmt.Sprintf("entry{address: %#x, file:%d, line: %d, col: %d, isStmt: %v}", e.Address, e.file, e.line, e.col, e.isStmt)
 }
 
 func (p Parameter) String() string {
-	return fmt.Sprintf("%s (%s)", p.Name, p.baseType.name)
+	return fmt.Sprintf("%s (%s)", p.Name, p.types.resolve(p.typeOffset).Name())
 }
 
 func (p *Parameter) AsVariable() *Variable {
@@ -118,7 +135,8 @@ func (p *Parameter) AsVariable() *Variable {
 
 	return &Variable{
 		name:                 p.Name,
-		baseType:             p.baseType,
+		typeOffset:           p.typeOffset,
+		types:                p.types,
 		locationInstructions: p.locationInstructions,
 
 		isFnParam: true,
@@ -134,7 +152,7 @@ func (dMap typeMap) String() string {
 }
 
 func (v *Variable) String() string {
-	return fmt.Sprintf("{name:%v, type: %v, location: %v}", v.name, v.baseType.name, v.locationInstructions)
+	return fmt.Sprintf("{name:%v, type: %v, location: %v}", v.name, v.Type().Name(), v.locationInstructions)
 }
 
 func (v *Variable) DecodeLocation(dRegisters DwarfRegisters) (address uint64, pieces []Piece, err error) {
@@ -142,7 +160,11 @@ func (v *Variable) DecodeLocation(dRegisters DwarfRegisters) (address uint64, pi
 }
 
 func (v *Variable) ByteSize() int64 {
-	return v.baseType.byteSize
+	return v.Type().ByteSize()
+}
+
+func (v *Variable) Type() *Type {
+	return v.types.resolve(v.typeOffset)
 }
 
 // func (li locationInstructions) String() string {
@@ -17,6 +17,9 @@ func ParseDwarfData(targetFile string) *DwarfData {
 	var currentModule *Module
 	var currentFunction *Function
 
+	// types whose children are being read, nil for entries other than types
+	var parentTypes []*Type
+
 	elfFile, err := elf.Open(targetFile)
 	if err != nil {
 		panic(err)
@@ -37,14 +40,46 @@ func ParseDwarfData(targetFile string) *DwarfData {
 			panic(err)
 		}
 
+		var parentType *Type
+		if len(parentTypes) > 0 {
+			parentType = parentTypes[len(parentTypes)-1]
+		}
+
+		var entryType *Type
+
 		switch entry.Tag {
 
-		// base type declaration
-		case dwarf.TagBaseType:
-			data.Types[entry.Offset] = &BaseType{
-				name:     entry.Val(dwarf.AttrName).(string),
-				byteSize: entry.Val(dwarf.AttrByteSize).(int64),
-				encoding: entry.Val(dwarf.AttrEncoding).(int64),
+		// end of the children of an entry
+		case 0:
+			if len(parentTypes) > 0 {
+				parentTypes = parentTypes[:len(parentTypes)-1]
+			}
+			continue
+
+		// type declarations
+		case dwarf.TagBaseType, dwarf.TagStructType, dwarf.TagUnionType, dwarf.TagArrayType, dwarf.TagPointerType,
+			dwarf.TagTypedef, dwarf.TagConstType, dwarf.TagVolatileType, dwarf.TagEnumerationType, dwarf.TagSubroutineType:
+			entryType = parseType(entry, data.Types)
+			data.Types[entry.Offset] = entryType
+
+		// member of a struct or union
+		case dwarf.TagMember:
+			if parentType != nil {
+				parentType.members = append(parentType.members, parseMember(entry, data.Types))
+			}
+
+		// dimension of an array
+		case dwarf.TagSubrangeType:
+			if parentType != nil && parentType.kind == KindArray {
+				parseArrayDimension(entry, parentType)
+			}
+
+		case dwarf.TagEnumerator:
+			if parentType != nil {
+				parentType.enumerators = append(parentType.enumerators, Enumerator{
+					Name:  entry.Val(dwarf.AttrName).(string),
+					Value: entry.Val(dwarf.AttrConstValue).(int64),
+				})
 			}
 
 		// entering a new module
@@ -62,24 +97,21 @@ func ParseDwarfData(targetFile string) *DwarfData {
 			currentModule.functions = append(currentModule.functions, currentFunction)
 
 		case dwarf.TagFormalParameter:
+			// parameters of function pointer types are not those of a function
+			if parentType != nil {
+				break
+			}
 			parameter := parseFunctionParameter(entry, data)
 
 			currentFunction.Parameters = append(currentFunction.Parameters, parameter)
 
 		// variable declaration
 		case dwarf.TagVariable:
-			baseType := data.Types[entry.Val(dwarf.AttrType).(dwarf.Offset)]
-
-			if baseType == nil {
-				baseType = &BaseType{
-					name: "unknown type",
-				}
-			}
-
 			variable := &Variable{
-				name:     entry.Val(dwarf.AttrName).(string),
-				baseType: baseType,
-				Function: currentFunction,
+				name:       entry.Val(dwarf.AttrName).(string),
+				typeOffset: typeOffset(entry),
+				types:      data.Types,
+				Function:   currentFunction,
 			}
 
 			locationInstructions := entry.Val(dwarf.AttrLocation)
@@ -94,27 +126,96 @@ func ParseDwarfData(targetFile string) *DwarfData {
 			// logger.Debug("unhandled tag type: %v", entry.Tag)
 		}
 
+		if entry.Children {
+			parentTypes = append(parentTypes, entryType)
+		}
 	}
 
 	return data
 }
 
-func parseFunctionParameter(entry *dwarf.Entry, data *DwarfData) *Parameter {
+// The offset of the type of the entry, 0 when it has none, as void pointers
+func typeOffset(entry *dwarf.Entry) dwarf.Offset {
+	offset, _ := entry.Val(dwarf.AttrType).(dwarf.Offset)
+	return offset
+}
 
-	baseType := data.Types[(entry.Val(dwarf.AttrType).(dwarf.Offset))]
+func parseType(entry *dwarf.Entry, types typeMap) *Type {
+	dataType := &Type{
+		target: typeOffset(entry),
+		types:  types,
+	}
 
-	if baseType == nil {
-		baseType = &BaseType{
-			name: "unknown type",
-		}
+	dataType.kind = map[dwarf.Tag]TypeKind{
+		dwarf.TagBaseType:        KindBase,
+		dwarf.TagStructType:      KindStruct,
+		dwarf.TagUnionType:       KindUnion,
+		dwarf.TagArrayType:       KindArray,
+		dwarf.TagPointerType:     KindPointer,
+		dwarf.TagTypedef:         KindTypedef,
+		dwarf.TagConstType:       KindConst,
+		dwarf.TagVolatileType:    KindVolatile,
+		dwarf.TagEnumerationType: KindEnum,
+		dwarf.TagSubroutineType:  KindFunction,
+	}[entry.Tag]
+
+	if name, ok := entry.Val(dwarf.AttrName).(string); ok {
+		dataType.name = name
+	}
+	if byteSize, ok := entry.Val(dwarf.AttrByteSize).(int64); ok {
+		dataType.byteSize = byteSize
+	}
+	if encoding, ok := entry.Val(dwarf.AttrEncoding).(int64); ok {
+		dataType.encoding = encoding
 	}
+
+	if dataType.kind == KindPointer && dataType.byteSize == 0 {
+		dataType.byteSize = int64(ptrSize())
+	}
+
+	return dataType
+}
+
+func parseMember(entry *dwarf.Entry, types typeMap) *Member {
+	member := &Member{
+		typeOffset: typeOffset(entry),
+		types:      types,
+	}
+
+	if name, ok := entry.Val(dwarf.AttrName).(string); ok {
+		member.Name = name
+	}
+	// members of unions have no location, they all start at 0
+	if offset, ok := entry.Val(dwarf.AttrDataMemberLoc).(int64); ok {
+		member.offset = offset
+	}
+
+	return member
+}
+
+// Each dimension of an array is a subrange entry, with the upper bound or count of the dimension
+func parseArrayDimension(entry *dwarf.Entry, array *Type) {
+	count := int64(-1)
+
+	if upperBound, ok := entry.Val(dwarf.AttrUpperBound).(int64); ok {
+		count = upperBound + 1
+	} else if elementCount, ok := entry.Val(dwarf.AttrCount).(int64); ok {
+		count = elementCount
+	}
+
+	array.dimensions = append(array.dimensions, count)
+}
+
+func parseFunctionParameter(entry *dwarf.Entry, data *DwarfData) *Parameter {
+
 	name := entry.Val(dwarf.AttrName)
 	if name == nil {
 		return nil
 	}
 	parameter := &Parameter{
 		Name:                 entry.Val(dwarf.AttrName).(string),
-		baseType:             baseType,
+		typeOffset:           typeOffset(entry),
+		types:                data.Types,
 		locationInstructions: entry.Val(dwarf.AttrLocation).([]byte),
 	}
 
@@ -136,6 +237,8 @@ func parseFunction(entry *dwarf.Entry, dwarfRawData *dwarf.Data) *Function {
 			function.line -= 10
 		case dwarf.AttrDeclColumn:
 			function.col = field.Val.(int64)
+		case dwarf.AttrType:
+			function.returnType = field.Val.(dwarf.Offset)
 		case dwarf.AttrFrameBase:
 
 			// buf := new(bytes.Buffer)
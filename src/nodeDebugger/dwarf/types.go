@@ -0,0 +1,215 @@
+package dwarf
+
+import (
+	"debug/dwarf"
+	"fmt"
+)
+
+type TypeKind int
+
+const (
+	KindUnknown TypeKind = iota
+	KindBase
+	KindStruct
+	KindUnion
+	KindArray
+	KindPointer
+	KindTypedef
+	KindConst
+	KindVolatile
+	KindEnum
+	KindFunction
+)
+
+// A type of the target, as declared by its DWARF entry.
+// Types refer to the types they are built of by offset, as these can be declared after them
+type Type struct {
+	kind        TypeKind
+	name        string
+	byteSize    int64
+	encoding    int64        // encoding of base types
+	target      dwarf.Offset // type pointed to, aliased or qualified, the element type of arrays, 0 for void
+	elem        *Type        // type pointed to by pointer types made by the debugger, which have no target offset
+	dimensions  []int64      // number of elements in each dimension of arrays, -1 when unknown
+	members     []*Member    // fields of structs and unions
+	enumerators []Enumerator // values of enums
+	types       typeMap      // the types of the target, resolving the target offset
+}
+
+type Member struct {
+	Name       string
+	offset     int64        // offset of the member in the struct
+	typeOffset dwarf.Offset // type of the member
+	types      typeMap
+}
+
+type Enumerator struct {
+	Name  string
+	Value int64
+}
+
+var unknownType = &Type{kind: KindUnknown, name: "unknown type"}
+
+// A base type not declared by the target, as the types of values computed by the debugger
+func NewBaseType(name string, byteSize int64, encoding int64) *Type {
+	return &Type{kind: KindBase, name: name, byteSize: byteSize, encoding: encoding}
+}
+
+// The type of pointers to values of the type, nil for void
+func PointerTo(t *Type) *Type {
+	return &Type{kind: KindPointer, byteSize: int64(ptrSize()), elem: t}
+}
+
+// Resolves a type referred to by offset, an unknown type when it was not declared
+func (dMap typeMap) resolve(offset dwarf.Offset) *Type {
+	if dataType := dMap[offset]; dataType != nil {
+		return dataType
+	}
+	return unknownType
+}
+
+func (t *Type) Kind() TypeKind {
+	return t.kind
+}
+
+// The name of the type as written in C, like struct point, int * or double[3]
+func (t *Type) Name() string {
+	switch t.kind {
+	case KindStruct, KindUnion, KindEnum:
+		keyword := map[TypeKind]string{KindStruct: "struct", KindUnion: "union", KindEnum: "enum"}[t.kind]
+		if t.name == "" {
+			return fmt.Sprintf("%v {...}", keyword)
+		}
+		return fmt.Sprintf("%v %v", keyword, t.name)
+	case KindPointer:
+		if t.Elem() == nil {
+			return "void *"
+		}
+		return t.Elem().Name() + " *"
+	case KindArray:
+		element := t.Elem()
+		for element.kind == KindArray {
+			element = element.Elem()
+		}
+		name := element.Name()
+		for _, count := range t.dimensions {
+			if count < 0 {
+				name += "[]"
+			} else {
+				name += fmt.Sprintf("[%d]", count)
+			}
+		}
+		return name
+	case KindConst, KindVolatile:
+		qualifier := map[TypeKind]string{KindConst: "const", KindVolatile: "volatile"}[t.kind]
+		if t.target == 0 {
+			return qualifier + " void"
+		}
+		return qualifier + " " + t.Elem().Name()
+	case KindFunction:
+		return "function"
+	}
+	return t.name
+}
+
+func (t *Type) ByteSize() int64 {
+	switch t.kind {
+	case KindTypedef, KindConst, KindVolatile:
+		return t.Elem().ByteSize()
+	case KindArray:
+		if t.Count() < 0 {
+			return 0
+		}
+		return t.Count() * t.Elem().ByteSize()
+	}
+	return t.byteSize
+}
+
+// The encoding of base types, and the one enums are stored with
+func (t *Type) Encoding() int64 {
+	t = t.Resolved()
+
+	if t.kind == KindEnum {
+		if t.target != 0 {
+			return t.Elem().Encoding()
+		}
+		// gcc stores enums as unsigned, unless some of the values are negative
+		for _, enumerator := range t.enumerators {
+			if enumerator.Value < 0 {
+				return EncodingSigned
+			}
+		}
+		return EncodingUnsigned
+	}
+
+	return t.encoding
+}
+
+// The type behind typedefs and qualifiers
+func (t *Type) Resolved() *Type {
+	for depth := 0; depth < 64; depth++ {
+		switch t.kind {
+		case KindTypedef, KindConst, KindVolatile:
+			t = t.Elem()
+		default:
+			return t
+		}
+	}
+	return unknownType
+}
+
+// The type pointed to, aliased or qualified, or the element type of an array.
+// The elements of multidimensional arrays are arrays of the remaining dimensions. Nil for void pointers
+func (t *Type) Elem() *Type {
+	if t.kind == KindArray && len(t.dimensions) > 1 {
+		return &Type{kind: KindArray, target: t.target, dimensions: t.dimensions[1:], types: t.types}
+	}
+	if t.elem != nil {
+		return t.elem
+	}
+	if t.target == 0 {
+		if t.kind == KindPointer {
+			return nil
+		}
+		return unknownType
+	}
+	return t.types.resolve(t.target)
+}
+
+// The number of elements of an array, -1 when unknown
+func (t *Type) Count() int64 {
+	if len(t.dimensions) == 0 {
+		return -1
+	}
+	return t.dimensions[0]
+}
+
+func (t *Type) Members() []*Member {
+	return t.members
+}
+
+// The member of a struct or union with the name, nil if there is none
+func (t *Type) Member(name string) *Member {
+	for _, member := range t.members {
+		if member.Name == name {
+			return member
+		}
+	}
+	return nil
+}
+
+func (t *Type) Enumerators() []Enumerator {
+	return t.enumerators
+}
+
+func (t *Type) String() string {
+	return t.Name()
+}
+
+func (m *Member) Offset() int64 {
+	return m.offset
+}
+
+func (m *Member) Type() *Type {
+	return m.types.resolve(m.typeOffset)
+}
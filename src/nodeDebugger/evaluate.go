@@ -0,0 +1,699 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/mihkeltiks/rev-mpi-deb/nodeDebugger/dwarf"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/expression"
+)
+
+// C expressions are evaluated over the memory of the target, with the usual arithmetic conversions simplified:
+// integers are computed as long, or unsigned long when either operand is unsigned, and any floating point
+// operand makes the result a double. Pointers and arrays take part in arithmetic and comparisons by address
+
+// types of the values computed by the debugger
+var (
+	intType          = dwarf.NewBaseType("int", 4, dwarf.EncodingSigned)
+	longType         = dwarf.NewBaseType("long", 8, dwarf.EncodingSigned)
+	unsignedLongType = dwarf.NewBaseType("unsigned long", 8, dwarf.EncodingUnsigned)
+	doubleType       = dwarf.NewBaseType("double", 8, dwarf.EncodingFloat)
+	charType         = dwarf.NewBaseType("char", 1, dwarf.EncodingSignedChar)
+)
+
+// C names of base types, as gcc writes them in the debug info
+var baseTypeNames = map[string]string{
+	"short":              "short int",
+	"unsigned short":     "short unsigned int",
+	"unsigned":           "unsigned int",
+	"signed":             "int",
+	"signed int":         "int",
+	"long":               "long int",
+	"unsigned long":      "long unsigned int",
+	"long unsigned":      "long unsigned int",
+	"long long":          "long long int",
+	"unsigned long long": "long long unsigned int",
+}
+
+// base types the target might not declare
+var builtinTypes = map[string]*dwarf.Type{
+	"char":                   charType,
+	"signed char":            dwarf.NewBaseType("signed char", 1, dwarf.EncodingSignedChar),
+	"unsigned char":          dwarf.NewBaseType("unsigned char", 1, dwarf.EncodingUnsignedChar),
+	"short int":              dwarf.NewBaseType("short int", 2, dwarf.EncodingSigned),
+	"short unsigned int":     dwarf.NewBaseType("short unsigned int", 2, dwarf.EncodingUnsigned),
+	"int":                    intType,
+	"unsigned int":           dwarf.NewBaseType("unsigned int", 4, dwarf.EncodingUnsigned),
+	"long int":               dwarf.NewBaseType("long int", 8, dwarf.EncodingSigned),
+	"long unsigned int":      dwarf.NewBaseType("long unsigned int", 8, dwarf.EncodingUnsigned),
+	"long long int":          dwarf.NewBaseType("long long int", 8, dwarf.EncodingSigned),
+	"long long unsigned int": dwarf.NewBaseType("long long unsigned int", 8, dwarf.EncodingUnsigned),
+	"float":                  dwarf.NewBaseType("float", 4, dwarf.EncodingFloat),
+	"double":                 doubleType,
+	"_Bool":                  dwarf.NewBaseType("_Bool", 1, dwarf.EncodingBoolean),
+}
+
+// A number taken from a scalar value
+type number struct {
+	isFloat  bool
+	float    float64
+	integer  int64
+	unsigned bool
+}
+
+func (n number) isZero() bool {
+	if n.isFloat {
+		return n.float == 0
+	}
+	return n.integer == 0
+}
+
+func (n number) asFloat() float64 {
+	switch {
+	case n.isFloat:
+		return n.float
+	case n.unsigned:
+		return float64(uint64(n.integer))
+	}
+	return float64(n.integer)
+}
+
+// Parses and evaluates an expression in the selected frame
+func evaluateSource(ctx *processContext, source string) (targetValue, error) {
+	expr, err := expression.Parse(source)
+	if err != nil {
+		return targetValue{}, err
+	}
+	return evaluate(ctx, expr)
+}
+
+func evaluate(ctx *processContext, expr expression.Expr) (targetValue, error) {
+	switch expr := expr.(type) {
+	case expression.Integer:
+		if expr.Unsigned {
+			return numberValue(number{integer: expr.Value, unsigned: true}), nil
+		}
+		if expr.Value >= math.MinInt32 && expr.Value <= math.MaxInt32 {
+			return computedValue(intType, encodeInteger(expr.Value, 4)), nil
+		}
+		return numberValue(number{integer: expr.Value}), nil
+
+	case expression.Float:
+		return numberValue(number{isFloat: true, float: expr.Value}), nil
+
+	case expression.Char:
+		return computedValue(charType, []byte{expr.Value}), nil
+
+	case expression.Identifier:
+		return evaluateIdentifier(ctx, expr.Name)
+
+	case expression.Unary:
+		return evaluateUnary(ctx, expr)
+
+	case expression.Binary:
+		return evaluateBinary(ctx, expr)
+
+	case expression.Cast:
+		return evaluateCast(ctx, expr)
+
+	case expression.Index:
+		array, err := evaluate(ctx, expr.Array)
+		if err != nil {
+			return targetValue{}, err
+		}
+		index, err := evaluateNumber(ctx, expr.Index)
+		if err != nil {
+			return targetValue{}, err
+		}
+		if index.isFloat {
+			return targetValue{}, fmt.Errorf("index %v of %v is not an integer", expr.Index, expr.Array)
+		}
+		return elementOf(ctx, array, index.integer, expr.Array)
+
+	case expression.Member:
+		operand, err := evaluate(ctx, expr.Operand)
+		if err != nil {
+			return targetValue{}, err
+		}
+		// as gdb does, members of structs pointed to can be accessed with . too
+		if expr.Arrow || operand.dataType.Resolved().Kind() == dwarf.KindPointer {
+			if operand, err = dereference(ctx, operand, expr.Operand); err != nil {
+				return targetValue{}, err
+			}
+		}
+		return memberOf(ctx, operand, expr.Name, expr.Operand)
+	}
+
+	return targetValue{}, fmt.Errorf("cannot evaluate %v", expr)
+}
+
+// Evaluates an expression to a number, as the conditions of breakpoints and indices are
+func evaluateNumber(ctx *processContext, expr expression.Expr) (number, error) {
+	value, err := evaluate(ctx, expr)
+	if err != nil {
+		return number{}, err
+	}
+	return toNumber(ctx, value, expr)
+}
+
+// Variables of the target are looked up in the selected frame, then among the globals, names starting with $ are registers.
+// rank refers to the MPI rank of the process, unless the target has a variable of that name in scope
+func evaluateIdentifier(ctx *processContext, name string) (targetValue, error) {
+	if strings.HasPrefix(name, "$") {
+		return registerValue(ctx, name)
+	}
+
+	variable, address := lookupVariable(ctx, name, true)
+
+	if variable != nil {
+		return targetValue{dataType: variable.Type(), address: address}, nil
+	}
+
+	if name == "rank" && ctx.nodeData != nil && ctx.nodeData.rank >= 0 {
+		return computedValue(intType, encodeInteger(int64(ctx.nodeData.rank), 4)), nil
+	}
+
+	return targetValue{}, fmt.Errorf("no variable %v in scope", name)
+}
+
+func evaluateUnary(ctx *processContext, expr expression.Unary) (targetValue, error) {
+	operand, err := evaluate(ctx, expr.Operand)
+	if err != nil {
+		return targetValue{}, err
+	}
+
+	switch expr.Op {
+	case "*":
+		return dereference(ctx, operand, expr.Operand)
+
+	case "&":
+		if operand.address == 0 {
+			return targetValue{}, fmt.Errorf("cannot take the address of %v, which is not in memory", expr.Operand)
+		}
+		return computedValue(dwarf.PointerTo(operand.dataType), encodeInteger(int64(operand.address), 8)), nil
+	}
+
+	value, err := toNumber(ctx, operand, expr.Operand)
+	if err != nil {
+		return targetValue{}, err
+	}
+
+	switch expr.Op {
+	case "!":
+		return boolValue(value.isZero()), nil
+	case "+":
+		return numberValue(value), nil
+	case "-":
+		if value.isFloat {
+			value.float = -value.float
+		} else {
+			value.integer = -value.integer
+		}
+		return numberValue(value), nil
+	case "~":
+		if value.isFloat {
+			return targetValue{}, fmt.Errorf("%v is not an integer", expr.Operand)
+		}
+		value.integer = ^value.integer
+		return numberValue(value), nil
+	}
+
+	return targetValue{}, fmt.Errorf("unknown operator %v", expr.Op)
+}
+
+func evaluateBinary(ctx *processContext, expr expression.Binary) (targetValue, error) {
+	if expr.Op == "+" || expr.Op == "-" {
+		if value, isPointer, err := pointerArithmetic(ctx, expr); isPointer || err != nil {
+			return value, err
+		}
+	}
+
+	left, err := evaluateNumber(ctx, expr.Left)
+	if err != nil {
+		return targetValue{}, err
+	}
+
+	// short-circuit, like C
+	if expr.Op == "&&" && left.isZero() {
+		return boolValue(false), nil
+	}
+	if expr.Op == "||" && !left.isZero() {
+		return boolValue(true), nil
+	}
+
+	right, err := evaluateNumber(ctx, expr.Right)
+	if err != nil {
+		return targetValue{}, err
+	}
+
+	switch expr.Op {
+	case "&&", "||":
+		return boolValue(!right.isZero()), nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		return boolValue(compare(expr.Op, left, right)), nil
+	}
+
+	if left.isFloat || right.isFloat {
+		l, r := left.asFloat(), right.asFloat()
+
+		switch expr.Op {
+		case "+":
+			return numberValue(number{isFloat: true, float: l + r}), nil
+		case "-":
+			return numberValue(number{isFloat: true, float: l - r}), nil
+		case "*":
+			return numberValue(number{isFloat: true, float: l * r}), nil
+		case "/":
+			return numberValue(number{isFloat: true, float: l / r}), nil
+		}
+		return targetValue{}, fmt.Errorf("operator %v needs integers, in %v", expr.Op, expr)
+	}
+
+	unsigned := left.unsigned || right.unsigned
+	l, r := left.integer, right.integer
+	result := number{unsigned: unsigned}
+
+	switch expr.Op {
+	case "+":
+		result.integer = l + r
+	case "-":
+		result.integer = l - r
+	case "*":
+		result.integer = l * r
+	case "/", "%":
+		if r == 0 {
+			return targetValue{}, fmt.Errorf("division by zero")
+		}
+		switch {
+		case expr.Op == "/" && unsigned:
+			result.integer = int64(uint64(l) / uint64(r))
+		case expr.Op == "/":
+			result.integer = l / r
+		case unsigned:
+			result.integer = int64(uint64(l) % uint64(r))
+		default:
+			result.integer = l % r
+		}
+	case "&":
+		result.integer = l & r
+	case "|":
+		result.integer = l | r
+	case "^":
+		result.integer = l ^ r
+	case "<<":
+		result.integer = l << uint64(r)
+	case ">>":
+		if unsigned {
+			result.integer = int64(uint64(l) >> uint64(r))
+		} else {
+			result.integer = l >> uint64(r)
+		}
+	default:
+		return targetValue{}, fmt.Errorf("unknown operator %v", expr.Op)
+	}
+
+	return numberValue(result), nil
+}
+
+func compare(op string, left number, right number) bool {
+	if left.isFloat || right.isFloat {
+		l, r := left.asFloat(), right.asFloat()
+		return map[string]bool{"==": l == r, "!=": l != r, "<": l < r, "<=": l <= r, ">": l > r, ">=": l >= r}[op]
+	}
+	if left.unsigned || right.unsigned {
+		l, r := uint64(left.integer), uint64(right.integer)
+		return map[string]bool{"==": l == r, "!=": l != r, "<": l < r, "<=": l <= r, ">": l > r, ">=": l >= r}[op]
+	}
+	l, r := left.integer, right.integer
+	return map[string]bool{"==": l == r, "!=": l != r, "<": l < r, "<=": l <= r, ">": l > r, ">=": l >= r}[op]
+}
+
+// Adds an integer to a pointer or array, or subtracts two pointers, counting in elements.
+// isPointer is false when neither operand is a pointer, for ordinary arithmetic
+func pointerArithmetic(ctx *processContext, expr expression.Binary) (value targetValue, isPointer bool, err error) {
+	left, err := evaluate(ctx, expr.Left)
+	if err != nil {
+		return targetValue{}, true, err
+	}
+	right, err := evaluate(ctx, expr.Right)
+	if err != nil {
+		return targetValue{}, true, err
+	}
+
+	leftPointer, rightPointer := isPointerLike(left), isPointerLike(right)
+
+	if !leftPointer && !rightPointer {
+		return targetValue{}, false, nil
+	}
+
+	if expr.Op == "+" && rightPointer && !leftPointer {
+		left, right = right, left
+		expr.Left, expr.Right = expr.Right, expr.Left
+	}
+
+	address, _ := toNumber(ctx, left, expr.Left)
+	element := pointedType(left)
+
+	if expr.Op == "-" && isPointerLike(right) {
+		other, _ := toNumber(ctx, right, expr.Right)
+		return numberValue(number{integer: (address.integer - other.integer) / elementSize(element)}), true, nil
+	}
+	if isPointerLike(right) {
+		return targetValue{}, true, fmt.Errorf("cannot add the pointers %v and %v", expr.Left, expr.Right)
+	}
+
+	offset, err := toNumber(ctx, right, expr.Right)
+	if err != nil {
+		return targetValue{}, true, err
+	}
+	if offset.isFloat {
+		return targetValue{}, true, fmt.Errorf("cannot add %v to a pointer", expr.Right)
+	}
+	if expr.Op == "-" {
+		offset.integer = -offset.integer
+	}
+
+	result := address.integer + offset.integer*elementSize(element)
+
+	return computedValue(dwarf.PointerTo(element), encodeInteger(result, 8)), true, nil
+}
+
+func isPointerLike(value targetValue) bool {
+	kind := value.dataType.Resolved().Kind()
+	return kind == dwarf.KindPointer || kind == dwarf.KindArray
+}
+
+// The type pointed to by a pointer, or of the elements of an array
+func pointedType(value targetValue) *dwarf.Type {
+	return value.dataType.Resolved().Elem()
+}
+
+// Size of the elements of pointer arithmetic, void pointers count in bytes as gcc does
+func elementSize(element *dwarf.Type) int64 {
+	if element == nil || element.ByteSize() == 0 {
+		return 1
+	}
+	return element.ByteSize()
+}
+
+func evaluateCast(ctx *processContext, expr expression.Cast) (targetValue, error) {
+	castType, err := lookupTypeName(ctx, expr.TypeName)
+	if err != nil {
+		return targetValue{}, err
+	}
+
+	operand, err := evaluate(ctx, expr.Operand)
+	if err != nil {
+		return targetValue{}, err
+	}
+
+	resolved := castType.Resolved()
+
+	switch resolved.Kind() {
+	case dwarf.KindBase, dwarf.KindEnum, dwarf.KindPointer:
+		value, err := toNumber(ctx, operand, expr.Operand)
+		if err != nil {
+			return targetValue{}, err
+		}
+		data, err := encodeNumber(value, resolved)
+		if err != nil {
+			return targetValue{}, err
+		}
+		return computedValue(castType, data), nil
+
+	case dwarf.KindStruct, dwarf.KindUnion:
+		// the operand is reinterpreted, as gdb does for values of the same size
+		if operand.dataType.ByteSize() != castType.ByteSize() {
+			return targetValue{}, fmt.Errorf("cannot cast %v to %v", expr.Operand, expr.TypeName)
+		}
+		operand.dataType = castType
+		return operand, nil
+	}
+
+	return targetValue{}, fmt.Errorf("cannot cast to %v", expr.TypeName)
+}
+
+// Finds the type written in a cast: a base type, typedef, struct, union or enum of the target,
+// followed by the stars of pointers. Qualifiers are left out
+func lookupTypeName(ctx *processContext, typeName string) (*dwarf.Type, error) {
+	pointers := strings.Count(typeName, "*")
+
+	words := []string{}
+	for _, word := range strings.Fields(strings.ReplaceAll(typeName, "*", " ")) {
+		if word != "const" && word != "volatile" {
+			words = append(words, word)
+		}
+	}
+	name := strings.Join(words, " ")
+
+	if alias, ok := baseTypeNames[name]; ok {
+		name = alias
+	}
+
+	var dataType *dwarf.Type
+
+	switch {
+	case name == "void" && pointers > 0:
+		pointers--
+		dataType = dwarf.PointerTo(nil)
+	case ctx.dwarfData.LookupType(name) != nil:
+		dataType = ctx.dwarfData.LookupType(name)
+	case builtinTypes[name] != nil:
+		dataType = builtinTypes[name]
+	default:
+		return nil, fmt.Errorf("no type named %v", name)
+	}
+
+	for ; pointers > 0; pointers-- {
+		dataType = dwarf.PointerTo(dataType)
+	}
+
+	return dataType, nil
+}
+
+// Takes the number a scalar holds. Pointers give their address and arrays the address of their first element
+func toNumber(ctx *processContext, value targetValue, expr expression.Expr) (number, error) {
+	resolved := value.dataType.Resolved()
+
+	switch resolved.Kind() {
+	case dwarf.KindArray:
+		if value.address == 0 {
+			return number{}, fmt.Errorf("%v is not in memory", expr)
+		}
+		return number{integer: int64(value.address), unsigned: true}, nil
+	case dwarf.KindPointer, dwarf.KindBase, dwarf.KindEnum:
+	default:
+		return number{}, fmt.Errorf("%v is not a number, but %v", expr, value.dataType.Name())
+	}
+
+	data, err := value.contents(ctx)
+	if err != nil {
+		return number{}, err
+	}
+	if resolved.Kind() == dwarf.KindPointer {
+		return number{integer: int64(binary.LittleEndian.Uint64(data)), unsigned: true}, nil
+	}
+
+	switch decoded := decodeBase(data, resolved).(type) {
+	case int8:
+		return number{integer: int64(decoded)}, nil
+	case int16:
+		return number{integer: int64(decoded)}, nil
+	case int32:
+		return number{integer: int64(decoded)}, nil
+	case int64:
+		return number{integer: decoded}, nil
+	case uint8:
+		return number{integer: int64(decoded)}, nil
+	case uint16:
+		return number{integer: int64(decoded)}, nil
+	case uint32:
+		return number{integer: int64(decoded)}, nil
+	case uint64:
+		return number{integer: int64(decoded), unsigned: true}, nil
+	case bool:
+		if decoded {
+			return number{integer: 1}, nil
+		}
+		return number{integer: 0}, nil
+	case float32:
+		return number{isFloat: true, float: float64(decoded)}, nil
+	case float64:
+		return number{isFloat: true, float: decoded}, nil
+	}
+
+	return number{}, fmt.Errorf("cannot decode %v of type %v", expr, value.dataType.Name())
+}
+
+// Encodes the number as a value of the base type, enum or pointer, converting it as a C cast does
+func encodeNumber(value number, dataType *dwarf.Type) ([]byte, error) {
+	size := dataType.ByteSize()
+
+	if dataType.Kind() == dwarf.KindPointer {
+		size = 8
+	}
+
+	switch {
+	case dataType.Kind() == dwarf.KindBase && dataType.Encoding() == dwarf.EncodingFloat:
+		data := make([]byte, size)
+		switch size {
+		case 4:
+			binary.LittleEndian.PutUint32(data, math.Float32bits(float32(value.asFloat())))
+		case 8:
+			binary.LittleEndian.PutUint64(data, math.Float64bits(value.asFloat()))
+		default:
+			return nil, fmt.Errorf("cannot convert to %v", dataType.Name())
+		}
+		return data, nil
+
+	case dataType.Kind() == dwarf.KindBase && dataType.Encoding() == dwarf.EncodingBoolean:
+		if value.isZero() {
+			return encodeInteger(0, size), nil
+		}
+		return encodeInteger(1, size), nil
+	}
+
+	integer := value.integer
+	if value.isFloat {
+		integer = int64(value.float)
+	}
+	if size != 1 && size != 2 && size != 4 && size != 8 {
+		return nil, fmt.Errorf("cannot convert to %v", dataType.Name())
+	}
+	return encodeInteger(integer, size), nil
+}
+
+// The low bytes of the integer, little endian
+func encodeInteger(value int64, size int64) []byte {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, uint64(value))
+	return data[:size]
+}
+
+func numberValue(value number) targetValue {
+	switch {
+	case value.isFloat:
+		data := make([]byte, 8)
+		binary.LittleEndian.PutUint64(data, math.Float64bits(value.float))
+		return computedValue(doubleType, data)
+	case value.unsigned:
+		return computedValue(unsignedLongType, encodeInteger(value.integer, 8))
+	}
+	return computedValue(longType, encodeInteger(value.integer, 8))
+}
+
+// The result of a comparison or logical operator, an int of 0 or 1
+func boolValue(value bool) targetValue {
+	if value {
+		return computedValue(intType, encodeInteger(1, 4))
+	}
+	return computedValue(intType, encodeInteger(0, 4))
+}
+
+func computedValue(dataType *dwarf.Type, data []byte) targetValue {
+	return targetValue{dataType: dataType, data: data}
+}
+
+func memberOf(ctx *processContext, value targetValue, name string, expr expression.Expr) (targetValue, error) {
+	resolved := value.dataType.Resolved()
+
+	if resolved.Kind() != dwarf.KindStruct && resolved.Kind() != dwarf.KindUnion {
+		return targetValue{}, fmt.Errorf("%v is not a struct or union, but %v", expr, value.dataType.Name())
+	}
+
+	member := resolved.Member(name)
+	if member == nil {
+		return targetValue{}, fmt.Errorf("%v has no member %v", value.dataType.Name(), name)
+	}
+
+	if value.address == 0 {
+		data := value.data
+		start, end := member.Offset(), member.Offset()+member.Type().ByteSize()
+		if end > int64(len(data)) {
+			return targetValue{}, fmt.Errorf("member %v lies outside of %v", name, expr)
+		}
+		return computedValue(member.Type(), data[start:end]), nil
+	}
+
+	return targetValue{dataType: member.Type(), address: value.address + uint64(member.Offset())}, nil
+}
+
+// The element at the index of an array, or the one counted from where the pointer points to
+func elementOf(ctx *processContext, value targetValue, index int64, expr expression.Expr) (targetValue, error) {
+	resolved := value.dataType.Resolved()
+	start := value.address
+
+	switch resolved.Kind() {
+	case dwarf.KindArray:
+		if count := resolved.Count(); count >= 0 && (index < 0 || index >= count) {
+			return targetValue{}, fmt.Errorf("index %d out of bounds of %v, which has %d elements", index, expr, count)
+		}
+		if value.address == 0 {
+			data, size := value.data, resolved.Elem().ByteSize()
+			if (index+1)*size > int64(len(data)) {
+				return targetValue{}, fmt.Errorf("index %d out of bounds of %v", index, expr)
+			}
+			return computedValue(resolved.Elem(), data[index*size:(index+1)*size]), nil
+		}
+	case dwarf.KindPointer:
+		pointer, err := pointerTarget(ctx, value, expr)
+		if err != nil {
+			return targetValue{}, err
+		}
+		start = pointer
+	default:
+		return targetValue{}, fmt.Errorf("%v is not an array or pointer, but %v", expr, value.dataType.Name())
+	}
+
+	element := resolved.Elem()
+
+	return objectAt(ctx, element, start+uint64(index*element.ByteSize()))
+}
+
+// The value a pointer points to, or the first element of an array
+func dereference(ctx *processContext, value targetValue, expr expression.Expr) (targetValue, error) {
+	resolved := value.dataType.Resolved()
+
+	if resolved.Kind() == dwarf.KindArray {
+		return elementOf(ctx, value, 0, expr)
+	}
+	if resolved.Kind() != dwarf.KindPointer {
+		return targetValue{}, fmt.Errorf("%v is not a pointer, but %v", expr, value.dataType.Name())
+	}
+
+	pointer, err := pointerTarget(ctx, value, expr)
+	if err != nil {
+		return targetValue{}, err
+	}
+
+	return objectAt(ctx, resolved.Elem(), pointer)
+}
+
+// The address a pointer to an object holds, which is not null
+func pointerTarget(ctx *processContext, value targetValue, expr expression.Expr) (uint64, error) {
+	if value.dataType.Resolved().Elem() == nil {
+		return 0, fmt.Errorf("%v is a void pointer", expr)
+	}
+
+	data, err := value.contents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pointer := binary.LittleEndian.Uint64(data)
+	if pointer == 0 {
+		return 0, fmt.Errorf("%v is a null pointer", expr)
+	}
+	return pointer, nil
+}
+
+// The object of the type at the address, which the target has to be able to read
+func objectAt(ctx *processContext, dataType *dwarf.Type, address uint64) (targetValue, error) {
+	// the first byte tells a mapped object, the rest is read when the value is used
+	if _, err := peekDataFromMemory(ctx, address, 1); err != nil {
+		return targetValue{}, err
+	}
+	return targetValue{dataType: dataType, address: address}, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"syscall"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/nodeDebugger/dwarf"
+	"github.com/mihkeltiks/rev-mpi-deb/rpc"
+	"github.com/mihkeltiks/rev-mpi-deb/utils"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// Inserts a breakpoint at the return address of the current frame, stopping the target when the function returns
+func insertFinishBreakpoint(ctx *processContext) error {
+	ctx.stack = getStack(ctx)
+
+	if len(ctx.stack) == 0 {
+		return fmt.Errorf("cannot finish: the call stack is unknown")
+	}
+
+	frame := ctx.stack[0]
+
+	if frame.name() == MAIN_FN || frame.returnAddress == 0 {
+		return fmt.Errorf("cannot finish: %v is the outermost frame", frame.name())
+	}
+
+	if existing := findBreakpointByAddress(ctx, frame.returnAddress); existing != nil {
+		if existing.isMPIBpoint {
+			return fmt.Errorf("cannot finish: the return address is used for tracking MPI calls")
+		}
+		// the breakpoint already there stops the target on return
+		logger.Info("Run till exit from %v", frame.name())
+		return nil
+	}
+
+	bpoint := insertReturnBreakpoint(ctx, frame.returnAddress, frame.baseAddress)
+	bpoint.finishing = frame.function
+
+	logger.Info("Run till exit from %v", frame.name())
+
+	return nil
+}
+
+// Inserts a breakpoint at a return address, stopping the target when the frame returns.
+// The frame is the base of the frame or the stack pointer at the entry of the function
+func insertReturnBreakpoint(ctx *processContext, address uint64, frame uint64) *bpointData {
+	line, file, _, _ := ctx.dwarfData.PCToLine(address)
+
+	bpoint := &bpointData{
+		address:             address,
+		originalInstruction: insertBreakpoint(ctx, address),
+		line:                line,
+		file:                file,
+		temporary:           true,
+		returnFrame:         frame,
+	}
+	ctx.bpointData[address] = bpoint
+
+	return bpoint
+}
+
+// Removes the return breakpoints left behind when the target stopped before the frame returned.
+// Those of watched locals stay until their frame returns
+func removeReturnBreakpoints(ctx *processContext) {
+	for address, bpoint := range ctx.bpointData {
+		if bpoint.returnFrame != 0 && bpoint.watchScope == nil {
+			_, err := syscall.PtracePokeData(ctx.pid, uintptr(address), bpoint.originalInstruction)
+			utils.Must(err)
+
+			delete(ctx.bpointData, address)
+		}
+	}
+}
+
+// Puts back a return breakpoint passed by a recursive call returning to the same address
+func reinsertReturnBreakpoint(ctx *processContext, bpoint *bpointData) {
+	bpoint.originalInstruction = insertBreakpoint(ctx, bpoint.address)
+	ctx.bpointData[bpoint.address] = bpoint
+}
+
+// Whether the target caught at a return breakpoint returned from the awaited frame.
+// Returns of deeper recursive calls of the function leave the stack pointer below the frame
+func returnedFromFrame(bpoint *bpointData, regs *syscall.PtraceRegs) bool {
+	return regs.Rsp > bpoint.returnFrame
+}
+
+// Reports the return of the finished function and prints its return value
+func reportFinish(ctx *processContext, bpoint *bpointData, regs *syscall.PtraceRegs) {
+	line, file, _, _ := ctx.dwarfData.PCToLine(regs.Rip)
+
+	logger.Info("%v returned to line %d in %v", bpoint.finishing.Name(), line, filepath.Base(file))
+
+	if bpoint.finishing.ReturnsValue() {
+		logger.Info("Value returned: %v", returnValue(ctx, bpoint.finishing, regs))
+	}
+
+	reportBreakpoint(ctx, rpc.BreakpointStop{NodeId: ctx.nodeData.id})
+}
+
+// The value returned by the function, read from rax or xmm0 as set by the System V calling convention
+func returnValue(ctx *processContext, function *dwarf.Function, regs *syscall.PtraceRegs) string {
+	returnType := ctx.dwarfData.ReturnType(function)
+	resolved := returnType.Resolved()
+
+	if kind := resolved.Kind(); kind != dwarf.KindBase && kind != dwarf.KindEnum && kind != dwarf.KindPointer {
+		// structs are returned in memory or spread over several registers
+		return fmt.Sprintf("%#x (%v)", regs.Rax, returnType.Name())
+	}
+
+	register := make([]byte, 8)
+	binary.LittleEndian.PutUint64(register, regs.Rax)
+
+	if resolved.Kind() == dwarf.KindBase && resolved.Encoding() == dwarf.EncodingFloat {
+		if resolved.ByteSize() > 8 {
+			return fmt.Sprintf("<%v returned on the x87 stack>", returnType.Name())
+		}
+
+		xmm0, err := getXmm0(ctx)
+		if err != nil {
+			logger.Warn("cannot read xmm0: %v", err)
+			return "?"
+		}
+		register = xmm0
+	}
+
+	return formatData(ctx, register, returnType, 0)
+}
+
+// Runs the target counter by counter up to the requested counter, sampling the frame at each one,
+// and reports the last counter at which the target was in the caller of the function it ends up in, 0 if there is none.
+// That counter is the statement calling the function, holding its return address
+func findCallSite(ctx *processContext, targetCounter int) (exited bool, err error) {
+	samples, frame, exited, err := sampleFrames(ctx, targetCounter)
+
+	callSite := 0
+
+	if !exited && err == nil && frame != nil && frame.name() != MAIN_FN {
+		// frames of callers lie above the frame of the function, the statements in it and its callees do not
+		for index := len(samples) - 1; index >= 0; index-- {
+			if samples[index].baseAddress > frame.baseAddress {
+				callSite = samples[index].counter
+				break
+			}
+		}
+
+		line, file, _, _ := ctx.dwarfData.PCToLine(frame.returnAddress)
+		logger.Debug("%v returns to line %d in %v, called at counter %d", frame.name(), line, filepath.Base(file), callSite)
+	}
+
+	reportCounter(ctx, &command.Command{NodeId: ctx.nodeData.id, Code: command.Retrieve, Argument: int32(callSite)})
+
+	return exited, err
+}
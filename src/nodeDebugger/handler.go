@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/binary"
 	"fmt"
-	"net/url"
 	"os"
 	"path/filepath"
 	"syscall"
@@ -15,6 +14,7 @@ import (
 	"github.com/mihkeltiks/rev-mpi-deb/rpc"
 	"github.com/mihkeltiks/rev-mpi-deb/utils"
 	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/expression"
 )
 
 type RemoteCmdHandler struct {
@@ -31,6 +31,7 @@ func (r RemoteCmdHandler) Handle(cmd *command.Command, reply *int) error {
 func handleCommand(ctx *processContext, cmd *command.Command) {
 	var err error
 	var exited bool
+	var atCounterTarget bool
 
 	// logger.Verbose("handling command %v", cmd)
 
@@ -38,16 +39,40 @@ func handleCommand(ctx *processContext, cmd *command.Command) {
 		reportProgressCommand(ctx, cmd)
 	}
 
+	if cmd.IsProgressCommand() {
+		// variables are printed in the innermost frame again
+		ctx.selectedFrame = 0
+	}
+
+	if runsTarget(cmd) {
+		ctx.interrupted = false
+		// only a supervised continue can end wherever the target is, other commands run to their own end
+		ctx.interruption.setRunning(true, cmd.IsSupervisedCont())
+		defer func() {
+			ctx.interruption.setRunning(false, false)
+			// a request arriving as the target stopped, the command has ended already
+			if !exited {
+				serveInterruption(ctx)
+			}
+		}()
+	}
+
 	switch cmd.Code {
 
 	case command.Bpoint:
-		err = setBreakPoint(ctx, ctx.sourceFile, cmd.Argument.(int))
+		err = setBreakPoint(ctx, cmd.Argument.(command.Breakpoint))
 	case command.SingleStep:
-		exited = SingleStep(ctx)
+		exited, err = stepLine(ctx, stepInto, 0)
 	case command.Next:
-		exited = continueExecution(ctx, false, true, false)
+		exited, err = stepLine(ctx, stepOver, 0)
+	case command.Until:
+		exited, err = stepLine(ctx, stepUntil, cmd.Argument.(int))
 	case command.Cont:
 		exited = continueExecution(ctx, false, false, false)
+	case command.Finish:
+		if err = insertFinishBreakpoint(ctx); err == nil {
+			exited = continueExecution(ctx, false, false, false)
+		}
 	case command.Restore:
 		checkpointId := cmd.Argument.(string)
 		err = restoreCheckpoint(ctx, checkpointId)
@@ -62,13 +87,36 @@ func handleCommand(ctx *processContext, cmd *command.Command) {
 		// logger.Verbose("RETRIEVING BREAKPOINTS")
 		retrieveBreakpoints(ctx)
 	case command.ChangeBreakpoints:
-		AddNewBreakpoints(ctx, cmd.Argument.([]int))
+		err = AddNewBreakpoints(ctx, cmd.Argument.([]command.Breakpoint))
 	case command.RemoveBreakpoints:
 		RemoveBreakpoints(ctx)
+	case command.RemoveBreakpoint:
+		err = removeBreakpoint(ctx, cmd.Argument.(int))
 	case command.Quit:
 		quitDebugger()
 	case command.Help:
 		printInstructions()
+	case command.LastChange:
+		exited, err = findLastChange(ctx, cmd.Argument.(command.VariableSampling))
+	case command.Locate:
+		err = locateVariable(ctx, cmd.Argument.(string))
+	case command.CallSite:
+		exited, err = findCallSite(ctx, cmd.Argument.(int))
+	case command.PreviousLine:
+		exited, err = findPreviousLine(ctx, cmd.Argument.(command.LineSampling))
+	case command.Backtrace:
+		ctx.stack = getStack(ctx)
+		reportStackTrace(ctx)
+	case command.Frame:
+		err = selectFrame(ctx, cmd.Argument.(int))
+	case command.MoveFrame:
+		err = selectFrame(ctx, ctx.selectedFrame+cmd.Argument.(int))
+	case command.Display:
+		err = addDisplay(ctx, cmd.Argument.(string))
+	case command.Undisplay:
+		err = removeDisplay(ctx, cmd.Argument.(int))
+	case command.SetVariable:
+		err = setVariable(ctx, cmd.Argument.(string))
 	case command.PrintInternal:
 		printInternalData(ctx, cmd.Argument.(string))
 	case command.Stop:
@@ -94,50 +142,45 @@ func handleCommand(ctx *processContext, cmd *command.Command) {
 		connect(ctx)
 	}
 
-	if cmd.IsForwardProgressCommand() {
+	// line steps handle the breakpoints on the way themselves
+	if (cmd.Code == command.Cont || cmd.Code == command.Finish) && err == nil {
 
 		for {
 			// logger.Verbose("STUCK HERE")
-			if exited {
+			if exited || ctx.interrupted {
 				break
 			}
 
-			target, _, _ := getVariableFromMemory(ctx, "target", true)
-			counter, _, _ := getVariableFromMemory(ctx, "counter", true)
-
-			if target == counter {
-				// For reverse continue recognize counter hit target
-				if cmd.Code == command.Cont && cmd.Argument != nil {
-					newCmd := command.Command{NodeId: ctx.nodeData.id, Code: command.CommandCode(-5)}
-					reportBreakpoint(ctx, &newCmd)
-				}
+			var atTarget bool
+			if atTarget, err = compareTargetAndCounter(ctx); err != nil {
 				break
 			}
 
-			bpoint, _, line := restoreCaughtBreakpoint(ctx)
-
-			if bpoint == nil {
+			if atTarget {
+				atCounterTarget = true
+				if cmd.IsSupervisedCont() {
+					// the target set by the orchestrator for an automatic checkpoint
+					ctx.interrupted = true
+				} else if cmd.Code == command.Cont && cmd.Argument != nil {
+					// For reverse continue recognize counter hit target
+					reportBreakpoint(ctx, rpc.BreakpointStop{NodeId: ctx.nodeData.id, CounterTarget: true})
+				}
 				break
 			}
 
-			if bpoint.isMPIBpoint {
-				ctx.stack = getStack(ctx)
-
-				// single-step, then insert all missing mpi bpoints
-				continueExecution(ctx, true, false, false)
-				reinsertMPIBPoints(ctx)
-
-				recordMPIOperation(ctx, bpoint)
+			if watchpoint := caughtWatchpoint(ctx); watchpoint != nil {
+				if watchpointStops(ctx, watchpoint) {
+					break
+				}
+				exited = continueExecution(ctx, false, false, false)
+				continue
 			}
 
-			if bpoint.ignoreFirstHit {
-				ctx.stack = getStack(ctx)
-				// single-step, then reinsert bp
-				continueExecution(ctx, true, false, false)
-				err = setBreakPoint(ctx, ctx.sourceFile, line)
-			}
+			var bpoint *bpointData
+			var stop bool
+			bpoint, stop, err = passCaughtBreakpoint(ctx)
 
-			if (!bpoint.isMPIBpoint && !bpoint.ignoreFirstHit) || cmd.Code == command.SingleStep {
+			if bpoint == nil || stop {
 				break
 			}
 
@@ -145,20 +188,38 @@ func handleCommand(ctx *processContext, cmd *command.Command) {
 		}
 	}
 
-	if cmd.Code == command.Cont && !exited {
+	if cmd.IsSupervisedCont() && !exited && !ctx.interrupted {
+		// the continue ended before the target of the automatic checkpoint, later commands run without one
+		changeValueOfTarget(noCounterTarget, ctx)
+	}
+
+	// a target stopped by the orchestrator may be anywhere, even in code without statements, and is resumed from there
+	if cmd.Code == command.Cont && !exited && (!ctx.interrupted || atCounterTarget) {
 		stepOutOfCounter(ctx)
 	}
 
+	if cmd.Code == command.Finish && !exited {
+		// the target stopped before the function returned
+		removeReturnBreakpoints(ctx)
+	}
+
 	if !exited && command.Detach != cmd.Code && command.Kill != cmd.Code && command.Stop != cmd.Code && cmd.Code != command.Reset {
 		ctx.stack = getStack(ctx)
 
 		if cmd.IsProgressCommand() {
+			deleteWatchpointsOutOfScope(ctx)
+		}
+
+		// an interrupted continue goes on once the orchestrator resumes it
+		if cmd.IsProgressCommand() && !ctx.interrupted {
 			logger.Info("call stack: %v", ctx.stack)
+			printDisplays(ctx)
 		}
 	}
 
 	cmd.Result = &command.CommandResult{
-		Exited: exited,
+		Exited:      exited,
+		Interrupted: ctx.interrupted && !exited,
 	}
 
 	if err != nil {
@@ -167,6 +228,11 @@ func handleCommand(ctx *processContext, cmd *command.Command) {
 
 }
 
+// Whether the command runs the target for an unknown time, during which other commands wait
+func runsTarget(cmd *command.Command) bool {
+	return cmd.IsForwardProgressCommand() || cmd.Code == command.LastChange || cmd.Code == command.CallSite || cmd.Code == command.PreviousLine
+}
+
 func disconnect(ctx *processContext) {
 	if ctx.nodeData != nil && ctx.nodeData.rpcClient != nil {
 		// Close the RPC connection
@@ -175,55 +241,171 @@ func disconnect(ctx *processContext) {
 }
 
 func connect(ctx *processContext) {
-	orchestratorAdress, _ := url.ParseRequestURI("localhost:3490")
+	orchestratorAdress := ctx.nodeData.orchestratorAddress
 	ctx.nodeData = &nodeData{
-		rpcClient: rpc.Connect(orchestratorAdress),
+		rpcClient:           rpc.Connect(orchestratorAdress),
+		orchestratorAddress: orchestratorAdress,
+		port:                ctx.nodeData.port,
+		rank:                ctx.nodeData.rank,
 	}
 
 	ctx.nodeData.id = reportAsHealthy(ctx)
-	logger.SetRemoteClient(ctx.nodeData.rpcClient, ctx.nodeData.id)
+	logger.SetRemoteClient(ctx.nodeData.rpcClient, ctx.nodeData.logId())
 
 	// logger.Info("Process (pid: %d) registered", os.Getpid())
 }
 
-func setBreakPoint(ctx *processContext, file string, line int) (err error) {
+func setBreakPoint(ctx *processContext, breakpoint command.Breakpoint) (err error) {
+	if breakpoint.Watch != "" {
+		if err := setWatchpoint(ctx, breakpoint); err != nil {
+			logger.Warn("%v", err)
+			return err
+		}
+		return nil
+	}
+
 	ignore := false
-	if line < 0 {
+	if breakpoint.Line < 0 {
 		// logger.Verbose("%v", line)
 		ignore = true
-		line = -line
+		breakpoint.Line = -breakpoint.Line
 	}
-	address, err := ctx.dwarfData.LineToPC(file, line)
+
+	location, err := resolveBreakpointLocation(ctx, breakpoint)
 
 	if err != nil {
-		logger.Warn("cannot set breakpoint at line: %v", err)
+		logger.Warn("cannot set breakpoint at %v: %v", breakpoint.Location(), err)
 		return err
 	}
 
-	logger.Info("setting breakpoint at line: %d", line)
-	originalInstruction := insertBreakpoint(ctx, address)
+	// a breakpoint inserted where the target is stopped is passed when execution continues
+	if getRegs(ctx, false).Rip == location.Address {
+		ignore = true
+	}
+
+	// one breakpoint per address: another one there keeps its settings, the breakpoint is set again only with its own id
+	existing := findBreakpointByAddress(ctx, location.Address)
+	if existing != nil {
+		switch {
+		case existing.isMPIBpoint:
+			err = fmt.Errorf("cannot set breakpoint at %v: the location is used for tracking MPI calls", location)
+		case existing.watchScope != nil:
+			err = fmt.Errorf("cannot set breakpoint at %v: the location is the return address of the frame of watched %v", location, existing.watchScope.spec.Watch)
+		case existing.returnFrame != 0:
+			err = fmt.Errorf("cannot set breakpoint at %v: the location is the return address awaited by finish or next", location)
+		case existing.id != 0 && existing.id != breakpoint.Id:
+			err = fmt.Errorf("cannot set breakpoint at %v: breakpoint %d is already set there", location, existing.id)
+		}
+		if err != nil {
+			logger.Warn("%v", err)
+			return err
+		}
+	}
+
+	if breakpoint.Id != 0 {
+		if previous := findBreakpointById(ctx, breakpoint.Id); previous != nil && previous.address != location.Address {
+			removeBreakpoint(ctx, breakpoint.Id)
+		}
+	}
 
-	ctx.bpointData[address] = &bpointData{
-		address:                 address,
+	if breakpoint.Condition != "" {
+		if _, err := expression.Parse(breakpoint.Condition); err != nil {
+			logger.Warn("cannot set breakpoint at %v: invalid condition: %v", location, err)
+			return err
+		}
+		logger.Info("setting breakpoint at %v if %v", location, breakpoint.Condition)
+	} else {
+		logger.Info("setting breakpoint at %v", location)
+	}
+
+	if existing != nil {
+		// only the settings change, the instruction is already replaced
+		existing.ignoreFirstHit = existing.ignoreFirstHit || ignore
+		existing.functionName = breakpoint.Function
+		existing.condition = breakpoint.Condition
+		existing.id = breakpoint.Id
+		existing.temporary = breakpoint.Temporary
+		existing.ignoreCount = breakpoint.IgnoreCount
+		return nil
+	}
+
+	originalInstruction := insertBreakpoint(ctx, location.Address)
+
+	ctx.bpointData[location.Address] = &bpointData{
+		address:                 location.Address,
 		originalInstruction:     originalInstruction,
 		function:                nil,
 		isMPIBpoint:             false,
 		isImmediateAfterRestore: false,
 		ignoreFirstHit:          ignore,
-		line:                    line,
+		line:                    location.Line,
+		file:                    location.File,
+		functionName:            breakpoint.Function,
+		condition:               breakpoint.Condition,
+		id:                      breakpoint.Id,
+		temporary:               breakpoint.Temporary,
+		ignoreCount:             breakpoint.IgnoreCount,
 	}
 
 	return nil
 }
 
-func SingleStep(ctx *processContext) bool {
-	intialValue := changeTargetForStep(ctx)
-	logger.Verbose("INITIAL %v", intialValue)
-	exited := continueExecution(ctx, false, false, true)
-	changeValueOfTarget(intialValue, ctx)
-	printInternalData(ctx, "loc")
-	stepOutOfCounter(ctx)
-	return exited
+// Runs the target to the next statement counter, passing breakpoints
+func stepCounter(ctx *processContext) (exited bool, err error) {
+	initialValue, err := changeTargetForStep(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if continueExecution(ctx, false, false, true) {
+		return true, nil
+	}
+
+	changeValueOfTarget(int(initialValue), ctx)
+	return stepOutOfCounter(ctx), nil
+}
+
+// Handles the breakpoint the target is caught at. MPI calls are recorded and breakpoints not stopping the target
+// are passed, the ones stopping it stay in place, to be passed when execution continues
+func passCaughtBreakpoint(ctx *processContext) (bpoint *bpointData, stop bool, err error) {
+	bpoint, _, line, stop := restoreCaughtBreakpoint(ctx)
+
+	if bpoint == nil {
+		return nil, false, nil
+	}
+
+	if bpoint.isMPIBpoint {
+		passMPIBreakpoint(ctx, bpoint)
+	}
+
+	if !bpoint.isMPIBpoint && !stop {
+		ctx.stack = getStack(ctx)
+		// single-step, then reinsert bp
+		continueExecution(ctx, true, false, false)
+		if bpoint.returnFrame != 0 {
+			reinsertReturnBreakpoint(ctx, bpoint)
+		} else {
+			err = setBreakPoint(ctx, bpoint.spec(line))
+		}
+	}
+
+	if stop && !bpoint.temporary {
+		// the breakpoint stays, it is passed when execution continues
+		err = setBreakPoint(ctx, bpoint.spec(-line))
+	}
+
+	return bpoint, stop, err
+}
+
+// Executes the MPI call the target is stopped at, after the breakpoint was restored, and records the operation
+func passMPIBreakpoint(ctx *processContext, bpoint *bpointData) {
+	ctx.stack = getStack(ctx)
+
+	// single-step, then insert all missing mpi bpoints
+	continueExecution(ctx, true, false, false)
+	reinsertMPIBPoints(ctx)
+
+	recordMPIOperation(ctx, bpoint)
 }
 
 func continueExecution(ctx *processContext, singleStep bool, next bool, counter bool) (exited bool) {
@@ -248,12 +430,37 @@ func continueExecution(ctx *processContext, singleStep bool, next bool, counter
 			return true
 		}
 
+		if waitStatus.StopSignal() == syscall.SIGSTOP {
+			// stopped by the orchestrator, or a stop left over from a request served already, which continuing discards
+			if serveInterruption(ctx) {
+				return false
+			}
+			i--
+			continue
+		}
+
 		if waitStatus.StopSignal() == syscall.SIGTRAP && waitStatus.TrapCause() != syscall.PTRACE_EVENT_CLONE {
 			// logger.Verbose("In here, binary hit trap, execution paused (wait status: %v, trap cause: %v)", waitStatus, waitStatus.TrapCause())
 			if counter {
-				if compareTargetAndCounter(ctx) {
+				if atTarget, err := compareTargetAndCounter(ctx); atTarget || err != nil {
+					if err != nil {
+						logger.Warn("stopping where the target is: %v", err)
+					}
 					return false
 				}
+
+				// stepping runs to the counter target, past the breakpoints and watchpoints on the way
+				if watchpoint := caughtWatchpoint(ctx); watchpoint != nil {
+					watchpoint.refreshValue(ctx)
+				}
+				if bpoint := findBreakpointByAddress(ctx, getRegs(ctx, true).Rip); bpoint != nil {
+					if bpoint.isMPIBpoint {
+						restoreCaughtBreakpoint(ctx)
+						passMPIBreakpoint(ctx, bpoint)
+					} else {
+						stepOverBreakpoint(ctx, bpoint)
+					}
+				}
 			} else {
 				return false
 			}
@@ -268,14 +475,19 @@ func continueExecution(ctx *processContext, singleStep bool, next bool, counter
 	return false
 }
 
-func AddNewBreakpoints(ctx *processContext, breakpoints []int) {
-	for _, line := range breakpoints {
-		err := setBreakPoint(ctx, ctx.sourceFile, line)
-		utils.Must(err)
+// Sets the breakpoints, the ones that cannot be set are skipped and the last error is returned
+func AddNewBreakpoints(ctx *processContext, breakpoints []command.Breakpoint) (err error) {
+	for _, breakpoint := range breakpoints {
+		if setErr := setBreakPoint(ctx, breakpoint); setErr != nil {
+			err = setErr
+		}
 	}
+	return err
 }
 
 func RemoveBreakpoints(ctx *processContext) {
+	removeWatchpoints(ctx)
+
 	for address, bpoint := range ctx.bpointData {
 		if !bpoint.isMPIBpoint {
 			_, err := syscall.PtracePokeData(ctx.pid, uintptr(address), bpoint.originalInstruction)
@@ -287,6 +499,28 @@ func RemoveBreakpoints(ctx *processContext) {
 	}
 }
 
+func removeBreakpoint(ctx *processContext, id int) error {
+	if watchpoint := findWatchpointById(ctx, id); watchpoint != nil {
+		removeWatchpoint(ctx, watchpoint)
+		logger.Info("removed watchpoint %d on %v", id, watchpoint.spec.Watch)
+		return nil
+	}
+
+	bpoint := findBreakpointById(ctx, id)
+
+	if bpoint == nil {
+		return fmt.Errorf("breakpoint %d is not set", id)
+	}
+
+	_, err := syscall.PtracePokeData(ctx.pid, uintptr(bpoint.address), bpoint.originalInstruction)
+	utils.Must(err)
+
+	delete(ctx.bpointData, bpoint.address)
+	logger.Info("removed breakpoint %d at line %d", id, bpoint.line)
+
+	return nil
+}
+
 func stepOutOfCounter(ctx *processContext) (exited bool) {
 	var waitStatus syscall.WaitStatus
 
@@ -313,22 +547,54 @@ func stepOutOfCounter(ctx *processContext) (exited bool) {
 
 }
 
-func printVariable(ctx *processContext, varName string) {
-	value, _, _ := getVariableFromMemory(ctx, varName, false)
-	if value == nil {
+// Prints the value of an expression over the variables in the selected frame, like s.field, a[i] * 2 or *ptr
+func printVariable(ctx *processContext, source string) {
+	value, err := evaluateSource(ctx, source)
+	if err != nil {
+		logger.Warn("cannot print %v: %v", source, err)
+		return
+	}
+
+	formatted, err := formatValue(ctx, value)
+	if err != nil {
+		logger.Warn("cannot print %v: %v", source, err)
 		return
 	}
 
-	fmt.Printf("Value of variable %s: %v\n", varName, value)
+	fmt.Printf("Value of %s: %v\n", source, formatted)
 }
 
 // Retrieves the value of a variable matching the specified idendifier, if present in the target
 func getVariableFromMemory(ctx *processContext, identifier string, suppressLogging bool) (value interface{}, address uint64, size int64) {
-	var variable *dwarf.Variable
-	var variableStackFunction *stackFunction
+	variable, address := lookupVariable(ctx, identifier, suppressLogging)
+
+	if variable == nil {
+		return nil, 0, 0
+	}
+
+	// logger.Debug("location of variable: %d", address)
 
-	// Process the call stack to find the matching variable
-	for _, stackFunction := range ctx.stack {
+	rawValue, err := peekDataFromMemory(ctx, address, variable.ByteSize())
+	if err != nil {
+		return nil, address, variable.ByteSize()
+	}
+	// rawValue := proc.ReadFromMemFile(ctx.pid, address, int(variable.baseType.byteSize))
+	// logger.Debug("raw value of variable: %v", rawValue)
+	// Convert the binary value to accurate type representation
+	return convertValueToType(rawValue, variable), address, variable.ByteSize()
+}
+
+// Finds the variable matching the identifier in the selected frame of the call stack or among the globals, and its address
+func lookupVariable(ctx *processContext, identifier string, suppressLogging bool) (variable *dwarf.Variable, address uint64) {
+	variable, address, _ = lookupVariableInFrame(ctx, identifier, ctx.stack.frame(ctx.selectedFrame), suppressLogging)
+	return variable, address
+}
+
+// Finds the variable matching the identifier in the frame or among the globals, its address,
+// and the frame it is declared in, nil for globals
+func lookupVariableInFrame(ctx *processContext, identifier string, stackFunction *stackFunction, suppressLogging bool) (variable *dwarf.Variable, address uint64, variableStackFunction *stackFunction) {
+	// code without debug information has no variables of its own
+	if stackFunction != nil && stackFunction.function != nil {
 		// Look for the variable declared in the stack function
 		variable = ctx.dwarfData.LookupVariableInFunction(stackFunction.function, identifier)
 
@@ -338,20 +604,14 @@ func getVariableFromMemory(ctx *processContext, identifier string, suppressLoggi
 			}
 
 			variableStackFunction = stackFunction
-			break
-		}
-
-		// Inspect the parameters of the stack function
-		matchingParameter := stackFunction.lookupParameter(identifier)
-
-		if matchingParameter != nil {
+		} else if matchingParameter := stackFunction.lookupParameter(identifier); matchingParameter != nil {
+			// Inspect the parameters of the stack function
 			if !suppressLogging {
 				logger.Verbose("Referring to variable %v as function parameter for function %v", identifier, stackFunction.function.Name())
 			}
 
 			variable = matchingParameter.AsVariable()
 			variableStackFunction = stackFunction
-			break
 		}
 	}
 
@@ -371,61 +631,55 @@ func getVariableFromMemory(ctx *processContext, identifier string, suppressLoggi
 			logger.Verbose("Cannot locate variable: %s", identifier)
 		}
 
-		return nil, 0, 0
+		return nil, 0, nil
 	}
 
-	var frameBase int64
-
-	if variableStackFunction != nil {
-		frameBase = int64(variableStackFunction.baseAddress + 16)
-	}
-
-	// Debug the variable location instructions to obtain memory address
-	address, _, err := variable.DecodeLocation(dwarf.DwarfRegisters{FrameBase: frameBase})
+	address, err := variableAddress(variable, variableStackFunction)
 
 	if err != nil {
 		logger.Error("Error decoding variable: %v", err)
-		return nil, 0, 0
+		return nil, 0, nil
 	}
 
 	if address == 0 {
 		logger.Warn("Cannot locate this variable")
-		return nil, 0, 0
+		return nil, 0, nil
 	}
 
-	// logger.Debug("location of variable: %d", address)
-
-	rawValue := peekDataFromMemory(ctx, address, variable.ByteSize())
-	// rawValue := proc.ReadFromMemFile(ctx.pid, address, int(variable.baseType.byteSize))
-	// logger.Debug("raw value of variable: %v", rawValue)
-	// Convert the binary value to accurate type representation
-	return convertValueToType(rawValue, variable), address, variable.ByteSize()
+	return variable, address, variableStackFunction
 }
 
-func peekDataFromMemory(ctx *processContext, address uint64, byteCount int64) []byte {
-	data := make([]byte, byteCount)
+// Decodes the address of a variable, declared in the stack function or global when it is nil
+func variableAddress(variable *dwarf.Variable, stackFunction *stackFunction) (uint64, error) {
+	var frameBase int64
 
-	syscall.PtracePeekData(ctx.pid, uintptr(address), data)
+	if stackFunction != nil {
+		frameBase = int64(stackFunction.canonicalFrameAddress())
+	}
 
-	return data
+	// Debug the variable location instructions to obtain memory address
+	address, _, err := variable.DecodeLocation(dwarf.DwarfRegisters{FrameBase: frameBase})
+	return address, err
 }
 
-func convertValueToType(data []byte, variable *dwarf.Variable) interface{} {
-
-	var value interface{}
+// Reads the memory of the target. Bytes that cannot be read are left zero, and the error tells where reading failed
+func peekDataFromMemory(ctx *processContext, address uint64, byteCount int64) ([]byte, error) {
+	data := make([]byte, byteCount)
 
-	switch variable.ByteSize() {
-	case 4:
-		value = int32(binary.LittleEndian.Uint32(data))
-	case 8:
-		value = int64(binary.LittleEndian.Uint64(data))
-	default:
-		logger.Error("unknown bytesize %v\n", variable)
+	if _, err := syscall.PtracePeekData(ctx.pid, uintptr(address), data); err != nil {
+		return data, fmt.Errorf("cannot access memory at %#x", address)
 	}
 
-	return value
+	return data, nil
+}
+
+func convertValueToType(data []byte, variable *dwarf.Variable) interface{} {
+	return decodeValue(data, variable.Type())
 }
 
+// Counter target of a target running without one, the counter never reaches it
+const noCounterTarget = 2000000
+
 func changeValueOfTarget(newValue int, ctx *processContext) {
 	_, address, size := getVariableFromMemory(ctx, "target", true)
 	bs := make([]byte, size)
@@ -434,30 +688,52 @@ func changeValueOfTarget(newValue int, ctx *processContext) {
 	utils.Must(err)
 }
 
-func compareTargetAndCounter(ctx *processContext) bool {
-	counter, _, _ := getVariableFromMemory(ctx, "counter", true)
-	target, _, _ := getVariableFromMemory(ctx, "target", true)
-	logger.Verbose("COUNTER %v", int(counter.(int32)))
-	logger.Verbose("TARGET %v", int(target.(int32)))
-	return counter.(int32) == target.(int32)
+// Reads the statement counter, or its target, as inserted by the compiler
+func readCounterVariable(ctx *processContext, name string) (int32, error) {
+	value, address, _ := getVariableFromMemory(ctx, name, true)
+
+	counterValue, ok := value.(int32)
+	if !ok {
+		if address == 0 {
+			return 0, fmt.Errorf("the target has no statement %v", name)
+		}
+		return 0, fmt.Errorf("cannot read the statement %v at %#x", name, address)
+	}
+	return counterValue, nil
 }
 
-func changeTargetForStep(ctx *processContext) int {
-	counter, _, _ := getVariableFromMemory(ctx, "counter", true)
-	target, address, size := getVariableFromMemory(ctx, "target", true)
+func compareTargetAndCounter(ctx *processContext) (bool, error) {
+	counter, err := readCounterVariable(ctx, "counter")
+	if err != nil {
+		return false, err
+	}
+	target, err := readCounterVariable(ctx, "target")
+	if err != nil {
+		return false, err
+	}
+	logger.Verbose("COUNTER %v", int(counter))
+	logger.Verbose("TARGET %v", int(target))
+	return counter == target, nil
+}
 
-	newValue := counter.(int32)
-	newValue++
+// Sets the counter target to the next statement, returns the target it replaced
+func changeTargetForStep(ctx *processContext) (int32, error) {
+	counter, err := readCounterVariable(ctx, "counter")
+	if err != nil {
+		return 0, err
+	}
+	target, err := readCounterVariable(ctx, "target")
+	if err != nil {
+		return 0, err
+	}
 
-	bs := make([]byte, size)
-	binary.LittleEndian.PutUint32(bs, uint32(newValue))
+	newValue := counter + 1
+	changeValueOfTarget(int(newValue), ctx)
 
-	_, err := syscall.PtracePokeData(ctx.pid, uintptr(address), bs)
-	utils.Must(err)
-	logger.Verbose("COUNTER IS %v", int(counter.(int32)))
+	logger.Verbose("COUNTER IS %v", int(counter))
 	logger.Verbose("TARGET SET TO %v", int(newValue))
 
-	return int(target.(int32))
+	return target, nil
 }
 
 func retrieveVariable(name string, ctx *processContext) {
@@ -469,15 +745,19 @@ func retrieveVariable(name string, ctx *processContext) {
 }
 
 func retrieveBreakpoints(ctx *processContext) {
-	var breakpoints []int
-	breakpoints = append(breakpoints, ctx.nodeData.id)
+	report := rpc.NodeBreakpoints{NodeId: ctx.nodeData.id}
 
 	for _, value := range ctx.bpointData {
-		if !value.isMPIBpoint {
-			breakpoints = append(breakpoints, value.line)
+		if !value.isMPIBpoint && value.returnFrame == 0 {
+			report.Breakpoints = append(report.Breakpoints, value.spec(value.line))
+		}
+	}
+	for _, watchpoint := range ctx.watchpoints {
+		if watchpoint != nil {
+			report.Breakpoints = append(report.Breakpoints, watchpoint.spec)
 		}
 	}
-	reportBreakpoints(ctx, &breakpoints)
+	reportBreakpoints(ctx, &report)
 }
 
 func printInternalData(ctx *processContext, varName string) {
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// Requests of the orchestrator served while a command runs the target, which cannot take other commands until it stops.
+// The target, possibly blocked in an mpi call waiting for another rank, is stopped with SIGSTOP to serve them
+type interruption struct {
+	mu        sync.Mutex
+	running   bool // a command is running the target
+	stoppable bool // the running command can end where the target is stopped, as continuing can
+	signalled bool // SIGSTOP was sent and the target has not yet stopped for it
+	backtrace bool // the call stack is requested, the target then runs on
+	stop      bool // the command is requested to end where the target stops
+}
+
+// Requests the interruption of the running target, returns false if no command is running it.
+// Backtrace reports the call stack, Stop ends a continue where the target stops
+func (i *interruption) interrupt(pid int, request command.CommandCode) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !i.running || (request == command.Stop && !i.stoppable) {
+		return false
+	}
+
+	if !i.signalled {
+		// only the traced thread is stopped, other threads of the target are not traced
+		if err := syscall.Tgkill(pid, pid, syscall.SIGSTOP); err != nil {
+			logger.Warn("cannot interrupt the target: %v", err)
+			return false
+		}
+		i.signalled = true
+	}
+
+	switch request {
+	case command.Backtrace:
+		i.backtrace = true
+	case command.Stop:
+		i.stop = true
+	}
+	return true
+}
+
+// Marks the start and the end of a command running the target
+func (i *interruption) setRunning(running bool, stoppable bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.running = running
+	i.stoppable = stoppable
+}
+
+// Takes the requests awaiting to be served
+func (i *interruption) take() (backtrace bool, stop bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	backtrace, stop = i.backtrace, i.stop
+	i.backtrace, i.stop, i.signalled = false, false, false
+	return backtrace, stop
+}
+
+// Serves the requests the target was stopped for, at any stop of the target.
+// Returns whether the running command is to end
+func serveInterruption(ctx *processContext) (stop bool) {
+	backtrace, stop := ctx.interruption.take()
+
+	if backtrace {
+		// the call stack of the command is kept
+		stack := ctx.stack
+		ctx.stack = getStack(ctx)
+		reportStackTrace(ctx)
+		ctx.stack = stack
+	}
+
+	if stop {
+		logger.Verbose("interrupted by the orchestrator")
+		ctx.interrupted = true
+	}
+
+	return stop
+}
+
+// Handles the commands served while a command runs the target
+func (r RemoteCmdHandler) Interrupt(request command.CommandCode, reply *int) error {
+	if r.ctx.interruption.interrupt(r.ctx.pid, request) {
+		*reply = 1
+	}
+	return nil
+}
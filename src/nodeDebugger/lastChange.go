@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/nodeDebugger/dwarf"
+	"github.com/mihkeltiks/rev-mpi-deb/rpc"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// Reports the address of the variable as seen from the selected frame, and the frame declaring it,
+// for the samplings of a replay to follow the same object
+func locateVariable(ctx *processContext, identifier string) error {
+	variable, address, frame := lookupVariableInFrame(ctx, identifier, ctx.stack.frame(ctx.selectedFrame), true)
+	if variable == nil {
+		return fmt.Errorf("cannot locate %v: variable not found", identifier)
+	}
+
+	location := rpc.VariableLocation{NodeId: ctx.nodeData.id, Address: address}
+	if frame != nil {
+		location.Frame = frame.canonicalFrameAddress()
+		location.Function = frame.function.Name()
+	}
+	reportVariableLocation(ctx, &location)
+
+	return nil
+}
+
+// Runs the target counter by counter up to the requested counter, sampling the variable at each one,
+// and reports the last counter at which the variable held a new value, 0 if it did not change.
+// The statement changing the variable is the one before that counter
+func findLastChange(ctx *processContext, sampling command.VariableSampling) (exited bool, err error) {
+	var variable *dwarf.Variable
+	var previous interface{}
+	lastChange := 0
+
+	for {
+		var counter int32
+		if counter, err = readCounterVariable(ctx, "counter"); err != nil {
+			break
+		}
+
+		if frame, live := samplingFrame(ctx, sampling); !live {
+			// an earlier call in the same place of the stack holds another object, its changes do not count
+			previous, lastChange = nil, 0
+		} else {
+			if variable == nil {
+				variable, _, _ = lookupVariableInFrame(ctx, sampling.Variable, frame, true)
+			}
+
+			if value := sampleValue(ctx, variable, sampling.Address); value != nil {
+				if previous != nil && fmt.Sprint(value) != fmt.Sprint(previous) {
+					logger.Debug("%v changed from %v to %v before counter %v", sampling.Variable, previous, value, counter)
+					lastChange = int(counter)
+				}
+				previous = value
+			}
+		}
+
+		if int(counter) >= sampling.Counter {
+			break
+		}
+
+		if exited, err = stepCounter(ctx); exited || err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		// the samples stop short of the counter, later changes may be missing
+		lastChange = 0
+	}
+
+	reportCounter(ctx, &command.Command{NodeId: ctx.nodeData.id, Code: command.Retrieve, Argument: int32(lastChange)})
+
+	return exited, err
+}
+
+// Reads the value of the variable at the address, nil if the variable is not found or its memory cannot be read
+func sampleValue(ctx *processContext, variable *dwarf.Variable, address uint64) interface{} {
+	if variable == nil {
+		return nil
+	}
+
+	data, err := peekDataFromMemory(ctx, address, variable.ByteSize())
+	if err != nil {
+		return nil
+	}
+	return convertValueToType(data, variable)
+}
+
+// Returns the frame declaring the sampled variable, and whether the variable is live:
+// globals always are, locals while their frame is on the call stack
+func samplingFrame(ctx *processContext, sampling command.VariableSampling) (frame *stackFunction, live bool) {
+	if sampling.Frame == 0 {
+		return nil, true
+	}
+
+	ctx.stack = getStack(ctx)
+	frame = ctx.stack.frameAt(sampling.Frame)
+
+	return frame, frame != nil && frame.function.Name() == sampling.Function
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/mihkeltiks/rev-mpi-deb/logger"
 	"github.com/mihkeltiks/rev-mpi-deb/nodeDebugger/dwarf"
@@ -54,13 +55,12 @@ func insertMPIBreakpoint(ctx *processContext, bpoint *bpointData, isImmediateAft
 	utils.Must(err)
 
 	ctx.bpointData[address] = &bpointData{
-		address,
-		bpoint.originalInstruction,
-		bpoint.function,
-		bpoint.isMPIBpoint,
-		isImmediateAfterRestore,
-		false,
-		line,
+		address:                 address,
+		originalInstruction:     bpoint.originalInstruction,
+		function:                bpoint.function,
+		isMPIBpoint:             bpoint.isMPIBpoint,
+		isImmediateAfterRestore: isImmediateAfterRestore,
+		line:                    line,
 	}
 }
 
@@ -79,13 +79,11 @@ func initMPIBreakpointsData(ctx *processContext) {
 		utils.Must(err)
 
 		MPI_BPOINTS[fName] = &bpointData{
-			breakAddress,
-			originalInstruction,
-			function,
-			true,
-			false,
-			false,
-			line,
+			address:             breakAddress,
+			originalInstruction: originalInstruction,
+			function:            function,
+			isMPIBpoint:         true,
+			line:                line,
 		}
 	}
 }
@@ -127,6 +125,14 @@ func recordMPIOperation(ctx *processContext, bpoint *bpointData) {
 		record.Parameters[varName] = fmt.Sprintf("%v", variableValue)
 	}
 
+	// MPI_Init is recorded on entry, before the wrapper stores the rank, so the rank assigned by the launcher is reported.
+	// Later calls report the rank stored by the wrapper
+	if rank, err := strconv.Atoi(record.Parameters["rank"]); err == nil && rank != ctx.nodeData.rank {
+		ctx.nodeData.rank = rank
+		logger.SetRemoteClient(ctx.nodeData.rpcClient, ctx.nodeData.logId())
+	}
+	record.Rank = ctx.nodeData.rank
+
 	logger.Debug("MPI Call record: %v", record)
 	reportMPICall(ctx, &record)
 }
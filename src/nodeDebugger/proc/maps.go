@@ -105,3 +105,27 @@ func LogMapsFile(pid int) {
 		logger.Debug("%v", region)
 	}
 }
+
+// Finds the file mapped at the address of the process, with the offset in the file the address corresponds to.
+// ok is false for addresses outside file mappings, like the stack or the heap
+func MappedFile(pid int, address uint64) (path string, fileOffset uint64, ok bool) {
+	for _, mmap := range readMapsFile(pid) {
+		// start-end perms offset dev inode path
+		if len(mmap) < 6 || !strings.HasPrefix(mmap[5], "/") {
+			continue
+		}
+
+		bounds := strings.Split(mmap[0], "-")
+		start, _ := strconv.ParseUint(bounds[0], 16, 64)
+		end, _ := strconv.ParseUint(bounds[1], 16, 64)
+
+		if address < start || address >= end {
+			continue
+		}
+
+		offset, _ := strconv.ParseUint(mmap[2], 16, 64)
+		return mmap[5], address - start + offset, true
+	}
+
+	return "", 0, false
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"syscall"
+	"unsafe"
 
 	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/nodeDebugger/dwarf"
 	"github.com/mihkeltiks/rev-mpi-deb/utils"
 )
 
@@ -47,3 +50,72 @@ func printRegs(ctx *processContext) {
 		fmt.Printf(" %s = %#x\n", typeOfT.Field(i).Name, f.Interface())
 	}
 }
+
+// gdb names of registers with other names in PtraceRegs
+var registerAliases = map[string]string{"pc": "rip", "sp": "rsp", "fp": "rbp"}
+
+// The field of the register named as in gdb, like $rax, $r8 or $eflags
+func registerField(regs *syscall.PtraceRegs, name string) (reflect.Value, error) {
+	name = strings.ToLower(strings.TrimPrefix(name, "$"))
+
+	if alias, ok := registerAliases[name]; ok {
+		name = alias
+	}
+
+	if name == "" {
+		return reflect.Value{}, fmt.Errorf("missing register name after $")
+	}
+
+	field := reflect.ValueOf(regs).Elem().FieldByName(strings.ToUpper(name[:1]) + name[1:])
+	if !field.IsValid() {
+		return reflect.Value{}, fmt.Errorf("no register $%v", name)
+	}
+
+	return field, nil
+}
+
+// Sets the register named as in gdb to the value
+func setRegister(ctx *processContext, name string, value uint64) error {
+	regs := getRegs(ctx, false)
+
+	field, err := registerField(regs, name)
+	if err != nil {
+		return err
+	}
+	field.SetUint(value)
+
+	return syscall.PtraceSetRegs(ctx.pid, regs)
+}
+
+// The value of a register, addresses held by the instruction, stack and frame pointers as void pointers
+func registerValue(ctx *processContext, name string) (targetValue, error) {
+	field, err := registerField(getRegs(ctx, false), name)
+	if err != nil {
+		return targetValue{}, err
+	}
+
+	dataType := longType
+	switch strings.ToLower(strings.TrimPrefix(name, "$")) {
+	case "rip", "rsp", "rbp", "pc", "sp", "fp":
+		dataType = dwarf.PointerTo(nil)
+	}
+
+	return computedValue(dataType, encodeInteger(int64(field.Uint()), 8)), nil
+}
+
+// offset of xmm0 in user_fpregs_struct (sys/user.h)
+const xmm0Offset = 160
+
+// Returns the low 8 bytes of xmm0, holding floating point return values
+func getXmm0(ctx *processContext) ([]byte, error) {
+	var fpregs [512]byte
+
+	_, _, errno := syscall.Syscall6(
+		syscall.SYS_PTRACE, syscall.PTRACE_GETFPREGS, uintptr(ctx.pid), 0, uintptr(unsafe.Pointer(&fpregs)), 0, 0,
+	)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	return fpregs[xmm0Offset : xmm0Offset+8], nil
+}
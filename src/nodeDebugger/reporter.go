@@ -9,7 +9,13 @@ import (
 )
 
 func reportAsHealthy(ctx *processContext) (nodeId int) {
-	err := ctx.nodeData.rpcClient.Call("NodeReporter.Register", os.Getpid(), &nodeId)
+	registration := rpc.NodeRegistration{
+		Pid:  os.Getpid(),
+		Port: ctx.nodeData.port,
+		Rank: ctx.nodeData.rank,
+	}
+
+	err := ctx.nodeData.rpcClient.Call("NodeReporter.Register", registration, &nodeId)
 	if err != nil {
 		logger.Error("Failed to report self as healthy: %v", err)
 		panic(err)
@@ -25,7 +31,7 @@ func reportCounter(ctx *processContext, cmd *command.Command) {
 	}
 }
 
-func reportBreakpoints(ctx *processContext, breakpoints *[]int) {
+func reportBreakpoints(ctx *processContext, breakpoints *rpc.NodeBreakpoints) {
 	err := ctx.nodeData.rpcClient.Call("NodeReporter.ReportBreakpoints", breakpoints, new(int))
 	if err != nil {
 		logger.Error("Failed to report self as healthy: %v", err)
@@ -33,6 +39,22 @@ func reportBreakpoints(ctx *processContext, breakpoints *[]int) {
 	}
 }
 
+func reportBacktrace(ctx *processContext, backtrace *rpc.NodeBacktrace) {
+	err := ctx.nodeData.rpcClient.Call("NodeReporter.ReportBacktrace", backtrace, new(int))
+	if err != nil {
+		logger.Error("Failed to report backtrace: %v", err)
+		panic(err)
+	}
+}
+
+func reportVariableLocation(ctx *processContext, location *rpc.VariableLocation) {
+	err := ctx.nodeData.rpcClient.Call("NodeReporter.ReportVariableLocation", location, new(int))
+	if err != nil {
+		logger.Error("Failed to report variable location: %v", err)
+		panic(err)
+	}
+}
+
 func reportCommandResult(ctx *processContext, cmd *command.Command) {
 	err := ctx.nodeData.rpcClient.Call("NodeReporter.CommandResult", cmd, new(int))
 	if err != nil {
@@ -41,14 +63,42 @@ func reportCommandResult(ctx *processContext, cmd *command.Command) {
 	}
 }
 
-func reportBreakpoint(ctx *processContext, cmd *command.Command) {
-	err := ctx.nodeData.rpcClient.Call("NodeReporter.Breakpoint", cmd, new(int))
+func reportBreakpoint(ctx *processContext, stop rpc.BreakpointStop) {
+	err := ctx.nodeData.rpcClient.Call("NodeReporter.Breakpoint", stop, new(int))
 	if err != nil {
 		logger.Error("Failed to report breakpoint information: %v", err)
 		panic(err)
 	}
 }
 
+// Reports the frame a numbered watchpoint on a local variable is bound to, or its deletion when the frame returned
+func reportWatchpointScope(ctx *processContext, scope rpc.WatchpointScope) {
+	if scope.BreakpointId == 0 {
+		return
+	}
+
+	err := ctx.nodeData.rpcClient.Call("NodeReporter.WatchpointScope", scope, new(int))
+	if err != nil {
+		logger.Error("Failed to report watchpoint scope: %v", err)
+		panic(err)
+	}
+}
+
+// Reports a hit of a numbered breakpoint, for the hit counts and ignore counts kept by the orchestrator
+func reportBreakpointHit(ctx *processContext, id int, ignored bool) {
+	if id == 0 {
+		return
+	}
+
+	hit := rpc.BreakpointHit{NodeId: ctx.nodeData.id, BreakpointId: id, Ignored: ignored}
+
+	err := ctx.nodeData.rpcClient.Call("NodeReporter.BreakpointHit", hit, new(int))
+	if err != nil {
+		logger.Error("Failed to report breakpoint hit: %v", err)
+		panic(err)
+	}
+}
+
 func reportProgressCommand(ctx *processContext, cmd *command.Command) {
 	err := ctx.nodeData.rpcClient.Call("NodeReporter.Progress", cmd, new(int))
 	if err != nil {
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/mihkeltiks/rev-mpi-deb/nodeDebugger/dwarf"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/expression"
+)
+
+// Assigns a value to a variable, or a member, element or pointee of it, or to a register, as in C: x = 3, a[2].v = 1.5 or $rax = 0.
+// The value is converted to the type of the variable and written to the memory of the target
+func setVariable(ctx *processContext, source string) error {
+	targetExpr, valueExpr, err := expression.ParseAssignment(source)
+	if err != nil {
+		return err
+	}
+
+	value, err := evaluate(ctx, valueExpr)
+	if err != nil {
+		return err
+	}
+
+	if register, ok := targetExpr.(expression.Identifier); ok && strings.HasPrefix(register.Name, "$") {
+		number, err := toNumber(ctx, value, valueExpr)
+		if err != nil {
+			return err
+		}
+		if number.isFloat {
+			number.integer = int64(number.float)
+		}
+		if err := setRegister(ctx, register.Name, uint64(number.integer)); err != nil {
+			return fmt.Errorf("cannot set %v: %v", register.Name, err)
+		}
+
+		printAssigned(ctx, targetExpr)
+		return nil
+	}
+
+	target, err := evaluate(ctx, targetExpr)
+	if err != nil {
+		return err
+	}
+	if target.address == 0 {
+		return fmt.Errorf("cannot assign to %v, which is not in memory", targetExpr)
+	}
+
+	data, err := convertForAssignment(ctx, value, valueExpr, target.dataType)
+	if err != nil {
+		return fmt.Errorf("cannot assign %v to %v: %v", valueExpr, targetExpr, err)
+	}
+
+	if err := pokeDataToMemory(ctx, target.address, data); err != nil {
+		return fmt.Errorf("cannot write %v at %#x: %v", targetExpr, target.address, err)
+	}
+
+	// the debugger writing to watched memory does not trigger the watchpoints, the new value is not a change made by the target
+	for _, watchpoint := range ctx.watchpoints {
+		if watchpoint != nil {
+			watchpoint.refreshValue(ctx)
+		}
+	}
+
+	printAssigned(ctx, targetExpr)
+	return nil
+}
+
+// Encodes the value as one of the type, as a C assignment converts it
+func convertForAssignment(ctx *processContext, value targetValue, valueExpr expression.Expr, dataType *dwarf.Type) ([]byte, error) {
+	resolved := dataType.Resolved()
+
+	switch resolved.Kind() {
+	case dwarf.KindBase, dwarf.KindEnum, dwarf.KindPointer:
+		number, err := toNumber(ctx, value, valueExpr)
+		if err != nil {
+			return nil, err
+		}
+		return encodeNumber(number, resolved)
+
+	case dwarf.KindStruct, dwarf.KindUnion:
+		if value.dataType.Resolved().Name() != resolved.Name() || value.dataType.ByteSize() != resolved.ByteSize() {
+			return nil, fmt.Errorf("%v is not a %v", valueExpr, dataType.Name())
+		}
+		return value.contents(ctx)
+	}
+
+	return nil, fmt.Errorf("values of type %v cannot be assigned", dataType.Name())
+}
+
+func printAssigned(ctx *processContext, targetExpr expression.Expr) {
+	value, err := evaluate(ctx, targetExpr)
+	if err != nil {
+		return
+	}
+	if formatted, err := formatValue(ctx, value); err == nil {
+		fmt.Printf("%v = %v\n", targetExpr, formatted)
+	}
+}
+
+func pokeDataToMemory(ctx *processContext, address uint64, data []byte) error {
+	_, err := syscall.PtracePokeData(ctx.pid, uintptr(address), data)
+	return err
+}
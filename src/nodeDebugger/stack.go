@@ -13,9 +13,12 @@ import (
 type programStack []*stackFunction // the current call stack of the program
 
 type stackFunction struct {
-	function     *dwarf.Function // definition of the function
-	baseAddress  uint64          // base address of the stack frame
-	stackAddress uint64
+	function      *dwarf.Function // definition of the function, nil for code without debug information
+	symbol        string          // name of the function from the symbol table, for code without debug information
+	baseAddress   uint64          // base address of the stack frame
+	stackAddress  uint64
+	pc            uint64 // the instruction executed in the frame, the return address of the frame above for callers
+	returnAddress uint64 // address the function returns to
 }
 
 func getLastExecutedFunction(stack programStack) *dwarf.Function {
@@ -28,7 +31,7 @@ func getLastExecutedFunction(stack programStack) *dwarf.Function {
 func (stack programStack) String() string {
 	str := ""
 	for index, stackFunction := range stack {
-		str = fmt.Sprintf("%s%v", str, stackFunction.function.Name())
+		str = fmt.Sprintf("%s%v", str, stackFunction.name())
 
 		if index != len(stack)-1 {
 			str = fmt.Sprintf("%s <- ", str)
@@ -38,6 +41,38 @@ func (stack programStack) String() string {
 	return str
 }
 
+// The name of the function of the frame, from the symbol table for code without debug information
+func (sf *stackFunction) name() string {
+	if sf.function != nil {
+		return sf.function.Name()
+	}
+	if sf.symbol != "" {
+		return sf.symbol
+	}
+	return "??"
+}
+
+// The canonical frame address of the frame, the stack pointer in the caller before the call.
+// Locals are addressed relative to it, and it tells frames of recursive calls apart
+func (sf *stackFunction) canonicalFrameAddress() uint64 {
+	return sf.baseAddress + 16
+}
+
+// Returns the frame with the canonical frame address, nil if it is not on the stack
+func (stack programStack) frameAt(canonicalFrameAddress uint64) *stackFunction {
+	for _, frame := range stack {
+		if frame.function != nil && frame.canonicalFrameAddress() == canonicalFrameAddress {
+			return frame
+		}
+	}
+	return nil
+}
+
+// Whether the stack was read up to main, frames missing from an incomplete stack may still be live
+func (stack programStack) complete() bool {
+	return len(stack) > 0 && stack[len(stack)-1].name() == MAIN_FN
+}
+
 func (sf stackFunction) lookupParameter(varName string) *dwarf.Parameter {
 	for _, param := range sf.function.Parameters {
 		if param.Name == varName {
@@ -58,72 +93,211 @@ func (stack programStack) lookupFunction(fn *dwarf.Function) *stackFunction {
 	return nil
 }
 
+// Frames deeper in the call stack are not read
+const maxStackDepth = 256
+
+// Bytes of the stack scanned for the return address of code without debug information
+const stackScanLimit = 16 << 10
+
+// Reads the call stack of the target by following the chain of saved base pointers.
+// The return address of each frame is stored above its saved base pointer.
+// Code without debug information, like the mpi library the target may be blocked in, is named from the symbol table
+// and need not keep a base pointer, so its caller is found by scanning the stack for a return address into code with debug information.
+// Frames of code without debug information called from each other are shown as the innermost one
 func getStack(ctx *processContext) programStack {
 	regs := getRegs(ctx, false)
 
-	stackPointer := regs.Rsp
+	ptrSize := uint64(utils.PtrSize())
+
+	pc := regs.Rip
 	basePointer := regs.Rbp
+	stackPointer := regs.Rsp
 
-	var offset uint64
+	fnStack := programStack{}
 
-	ptrSize := uint64(utils.PtrSize())
+	for len(fnStack) < maxStackDepth {
+		fn := ctx.dwarfData.PCToFunc(pc)
 
-	fn := ctx.dwarfData.PCToFunc(regs.Rip)
+		if fn == nil {
+			returnSlot, found := findReturnAddress(ctx, stackPointer)
 
-	if fn == nil {
-		return nil
-	}
+			frame := &stackFunction{
+				symbol:       symbolName(ctx, pc),
+				stackAddress: stackPointer,
+				pc:           pc,
+			}
+			fnStack = append(fnStack, frame)
 
-	fnStack := programStack{
-		&stackFunction{
-			function:     fn,
-			baseAddress:  basePointer,
-			stackAddress: stackPointer,
-		},
-	}
+			if !found {
+				break
+			}
+			// laid out as a frame with a base pointer, so that the return address lies above its base
+			frame.baseAddress = returnSlot - ptrSize
+			frame.returnAddress, _ = readWord(ctx, returnSlot)
 
-	for {
-		offset = 0
+			basePointer, found = callerBasePointer(ctx, basePointer, returnSlot, frame.returnAddress)
+			if !found {
+				logger.Debug("no base pointer of the caller above the return address at %#x", returnSlot)
+				break
+			}
 
-		frameSize := stackPointer - basePointer + ptrSize
+			stackPointer = returnSlot + ptrSize
+			pc = frame.returnAddress
+			continue
+		}
 
-		if frameSize > 1024 || frameSize == 0 {
-			logger.Debug("invalid base pointer or frame size")
-			frameSize = 32
+		frameData := make([]byte, 2*ptrSize)
+		if _, err := syscall.PtracePeekData(ctx.pid, uintptr(basePointer), frameData); err != nil {
+			logger.Debug("invalid base pointer %#x in function %v", basePointer, fn.Name())
+			break
 		}
 
-		frameData := make([]byte, frameSize)
-		_, err := syscall.PtracePeekData(ctx.pid, uintptr(stackPointer), frameData)
-		if err != nil {
+		frame := &stackFunction{
+			function:      fn,
+			baseAddress:   basePointer,
+			stackAddress:  stackPointer,
+			pc:            pc,
+			returnAddress: binary.LittleEndian.Uint64(frameData[ptrSize:]),
+		}
+		fnStack = append(fnStack, frame)
+
+		// end of stack
+		if fn.Name() == MAIN_FN {
 			break
 		}
 
-		// First instruction in frame - return address from stack frame
-		stackContent := binary.LittleEndian.Uint64(frameData[:ptrSize])
+		// continue in the frame of the caller
+		stackPointer = basePointer + 2*ptrSize
+		basePointer = binary.LittleEndian.Uint64(frameData[:ptrSize])
+		pc = frame.returnAddress
+	}
+
+	return fnStack
+}
+
+// Scans the stack from the stack pointer for the first return address into code with debug information,
+// a word pointing to such code right after a call instruction. Returns the address of the word
+func findReturnAddress(ctx *processContext, stackPointer uint64) (returnSlot uint64, found bool) {
+	ptrSize := uint64(utils.PtrSize())
+
+	stack := make([]byte, stackScanLimit)
+	// the read stops at the end of the stack
+	count, _ := syscall.PtracePeekData(ctx.pid, uintptr(stackPointer), stack)
 
-		fn = ctx.dwarfData.PCToFunc(stackContent)
+	for offset := uint64(0); offset+ptrSize <= uint64(count); offset += ptrSize {
+		address := binary.LittleEndian.Uint64(stack[offset:])
 
-		if fn != nil {
-			fnStack = append(fnStack, &stackFunction{function: fn, baseAddress: basePointer, stackAddress: stackPointer})
+		if ctx.dwarfData.PCToFunc(address) != nil && followsCall(ctx, address) {
+			return stackPointer + offset, true
 		}
+	}
 
-		for offset = 0; offset < frameSize; offset += ptrSize {
+	return 0, false
+}
 
-			stackContent = binary.LittleEndian.Uint64(frameData[offset : offset+ptrSize])
+// Finds the base pointer of the caller of code without debug information, from the return address into the caller.
+// It is the first one of the chain of base pointers above the return address if the code kept the chain,
+// else the first word above it that is laid out as a saved base pointer below a return address
+func callerBasePointer(ctx *processContext, basePointer uint64, returnSlot uint64, returnAddress uint64) (uint64, bool) {
+	ptrSize := uint64(utils.PtrSize())
 
-			if offset == frameSize-ptrSize {
-				basePointer = stackContent
-				break
-			}
+	// the caller of main is not followed, the base pointer it saved may be anything
+	isMain := ctx.dwarfData.PCToFunc(returnAddress).Name() == MAIN_FN
+
+	isFrame := func(address uint64) bool {
+		saved, err := readWord(ctx, address)
+		if err != nil {
+			return false
+		}
+		savedReturnAddress, err := readWord(ctx, address+ptrSize)
+		if err != nil || !followsCall(ctx, savedReturnAddress) {
+			return false
 		}
+		return isMain || saved > address
+	}
 
-		// end of stack
-		if fn.Name() == MAIN_FN {
+	for basePointer != 0 && basePointer <= returnSlot {
+		next, err := readWord(ctx, basePointer)
+		if err != nil || next <= basePointer {
+			basePointer = 0
 			break
 		}
+		basePointer = next
+	}
+	if basePointer != 0 && basePointer-returnSlot < stackScanLimit && isFrame(basePointer) {
+		return basePointer, true
+	}
 
-		stackPointer += frameSize
+	for address := returnSlot + ptrSize; address < returnSlot+stackScanLimit; address += ptrSize {
+		if isFrame(address) {
+			return address, true
+		}
 	}
 
-	return fnStack
+	return 0, false
+}
+
+// Whether the instruction before the address is a call, making the address a return address
+func followsCall(ctx *processContext, address uint64) bool {
+	code := make([]byte, 7)
+	if _, err := syscall.PtracePeekData(ctx.pid, uintptr(address-7), code); err != nil {
+		return false
+	}
+
+	// the reg field of the modrm byte of an indirect call is 2
+	indirect := func(modrm byte) bool { return (modrm>>3)&7 == 2 }
+
+	return code[2] == 0xe8 || // call rel32
+		(code[1] == 0xff && indirect(code[2])) || // call [rip+disp32]
+		(code[4] == 0xff && indirect(code[5])) || // call [reg+disp8]
+		(code[5] == 0xff && indirect(code[6])) // call reg
+}
+
+func readWord(ctx *processContext, address uint64) (uint64, error) {
+	data := make([]byte, utils.PtrSize())
+	if _, err := syscall.PtracePeekData(ctx.pid, uintptr(address), data); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(data), nil
+}
+
+// Returns the frame at the index of the stack, counting from the innermost one, nil if there is none
+func (stack programStack) frame(index int) *stackFunction {
+	if index < 0 || index >= len(stack) {
+		return nil
+	}
+	return stack[index]
+}
+
+// The innermost frame of the target and its line at a statement counter
+type frameSample struct {
+	counter     int
+	baseAddress uint64
+	line        int
+}
+
+// Runs the target counter by counter up to the requested counter, sampling the innermost frame at each one.
+// Returns the samples and the frame the target ends up in
+func sampleFrames(ctx *processContext, targetCounter int) (samples []frameSample, frame *stackFunction, exited bool, err error) {
+	for {
+		counter, err := readCounterVariable(ctx, "counter")
+		if err != nil {
+			return samples, frame, false, err
+		}
+
+		ctx.stack = getStack(ctx)
+		if len(ctx.stack) > 0 {
+			frame = ctx.stack[0]
+			line, _ := ctx.dwarfData.LineContaining(getRegs(ctx, false).Rip)
+			samples = append(samples, frameSample{int(counter), frame.baseAddress, line})
+		}
+
+		if int(counter) >= targetCounter {
+			return samples, frame, false, nil
+		}
+
+		if exited, err = stepCounter(ctx); exited || err != nil {
+			return samples, frame, exited, err
+		}
+	}
 }
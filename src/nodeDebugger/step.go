@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"syscall"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// Source level stepping: the target is single-stepped by instructions until it reaches the start of a statement
+// on another line, according to the line table. Calls stepped over, and the calls of the statement counter
+// starting each instrumented statement, run to a breakpoint at their return address.
+// A statement starting with a call of the counter is stopped at after the call, as reverse execution does
+
+type stepMode int
+
+const (
+	stepInto  stepMode = iota // step, entering the functions called
+	stepOver                  // next, over the functions called
+	stepUntil                 // until, over the functions called and not back to earlier lines of the frame
+)
+
+// Runs the target to the next source line. Until runs to a line after the current one, or to untilLine when set,
+// in the current frame, or until the frame returns. Breakpoints and watchpoints on the way stop the target
+func stepLine(ctx *processContext, mode stepMode, untilLine int) (exited bool, err error) {
+	regs := getRegs(ctx, false)
+	fromLine, fromFile := ctx.dwarfData.LineContaining(regs.Rip)
+
+	depth := 0 // of the frame the target is in, relative to the frame stepped in
+	atStatement := false
+
+	for {
+		before := regs
+
+		var stop bool
+		if exited, stop, err = stepInstruction(ctx); exited || stop || err != nil {
+			return exited, err
+		}
+
+		regs = getRegs(ctx, false)
+		called, returned := callOrReturn(ctx, before, regs)
+
+		if called {
+			function := ctx.dwarfData.PCToFunc(regs.Rip)
+
+			if mode == stepInto && function != nil && function.Name() != COUNTER_FN {
+				depth++
+				continue
+			}
+
+			// the stack pointer always points to memory of the target
+			data, _ := peekDataFromMemory(ctx, regs.Rsp, 8)
+			returnAddress := binary.LittleEndian.Uint64(data)
+
+			if exited, stop, err = runToReturn(ctx, returnAddress, regs.Rsp); exited || stop || err != nil {
+				return exited, err
+			}
+			regs = getRegs(ctx, false)
+
+			if atStatement && function != nil && function.Name() == COUNTER_FN {
+				break
+			}
+			continue
+		}
+
+		if returned {
+			depth--
+
+			if depth < 0 {
+				if ctx.dwarfData.PCToFunc(regs.Rip) == nil {
+					// returned from main, there are no more lines to step to
+					return continueExecution(ctx, false, false, false), nil
+				}
+				if mode == stepUntil {
+					break
+				}
+				// the rest of the line of the caller is stepped over
+				depth = 0
+				fromLine, fromFile = ctx.dwarfData.LineContaining(regs.Rip)
+			}
+			continue
+		}
+
+		if !ctx.dwarfData.IsStatementStart(regs.Rip) {
+			continue
+		}
+
+		line, file := ctx.dwarfData.LineContaining(regs.Rip)
+		function := ctx.dwarfData.PCToFunc(regs.Rip)
+
+		if line <= 0 || function == nil || regs.Rip == function.LowPC() {
+			// the statement counter, or the prologue of a function
+			continue
+		}
+
+		switch mode {
+		case stepUntil:
+			if depth != 0 || (untilLine == 0 && line <= fromLine) || (untilLine != 0 && line != untilLine) {
+				continue
+			}
+		default:
+			if depth == 0 && line == fromLine && file == fromFile {
+				continue
+			}
+		}
+
+		if !callsCounter(ctx, regs.Rip) {
+			break
+		}
+		// stop once the counter of the statement is called
+		atStatement = true
+	}
+
+	// a breakpoint where the target stops is passed when execution continues
+	if bpoint := findBreakpointByAddress(ctx, regs.Rip); bpoint != nil && !bpoint.isMPIBpoint {
+		bpoint.ignoreFirstHit = true
+	}
+
+	line, file, _, _ := ctx.dwarfData.PCToLine(regs.Rip)
+	if line == 0 {
+		line, file = ctx.dwarfData.LineContaining(regs.Rip)
+	}
+	logger.Info("stepped to line %d in %v", line, filepath.Base(file))
+
+	return false, nil
+}
+
+// Executes a single instruction, passing the breakpoint at the instruction pointer, if any
+func stepInstruction(ctx *processContext) (exited bool, stop bool, err error) {
+	regs := getRegs(ctx, false)
+	planted := findBreakpointByAddress(ctx, regs.Rip) != nil
+
+	if exited = continueExecution(ctx, true, false, false); exited {
+		return true, false, nil
+	}
+
+	if watchpoint := caughtWatchpoint(ctx); watchpoint != nil && watchpointStops(ctx, watchpoint) {
+		return false, true, nil
+	}
+
+	if planted && getRegs(ctx, false).Rip == regs.Rip+1 {
+		_, stop, err = passCaughtBreakpoint(ctx)
+	}
+
+	return false, stop, err
+}
+
+// Runs the target until the function it has just entered returns to the return address.
+// The stack pointer at the entry of the function tells its return from the returns of recursive calls
+func runToReturn(ctx *processContext, returnAddress uint64, entryStackPointer uint64) (exited bool, stop bool, err error) {
+	returnBpoint := findBreakpointByAddress(ctx, returnAddress)
+	if returnBpoint == nil {
+		returnBpoint = insertReturnBreakpoint(ctx, returnAddress, entryStackPointer)
+	}
+
+	for {
+		if exited = continueExecution(ctx, false, false, false); exited {
+			return true, false, nil
+		}
+
+		if watchpoint := caughtWatchpoint(ctx); watchpoint != nil {
+			if watchpointStops(ctx, watchpoint) {
+				removeReturnBreakpoints(ctx)
+				return false, true, nil
+			}
+			continue
+		}
+
+		var bpoint *bpointData
+		bpoint, stop, err = passCaughtBreakpoint(ctx)
+
+		if err != nil {
+			removeReturnBreakpoints(ctx)
+			return false, false, err
+		}
+		if bpoint == returnBpoint && stop && returnBpoint.returnFrame != 0 {
+			return false, false, nil
+		}
+		if stop {
+			// a breakpoint in the function called
+			removeReturnBreakpoints(ctx)
+			return false, true, nil
+		}
+	}
+}
+
+// Tells whether the instruction executed between the register states was a call or a return
+func callOrReturn(ctx *processContext, before *syscall.PtraceRegs, after *syscall.PtraceRegs) (called bool, returned bool) {
+	// instructions are at most 15 bytes long
+	const maxInstructionLength = 15
+
+	switch after.Rsp {
+	case before.Rsp - 8:
+		data, _ := peekDataFromMemory(ctx, after.Rsp, 8)
+		returnAddress := binary.LittleEndian.Uint64(data)
+		called = returnAddress > before.Rip && returnAddress-before.Rip <= maxInstructionLength && after.Rip != returnAddress
+	case before.Rsp + 8:
+		data, _ := peekDataFromMemory(ctx, before.Rsp, 8)
+		returnAddress := binary.LittleEndian.Uint64(data)
+		returned = after.Rip == returnAddress
+	}
+
+	return called, returned
+}
+
+// Whether the statement at the address starts with a call of the statement counter, as inserted by the compiler
+func callsCounter(ctx *processContext, address uint64) bool {
+	code, err := peekDataFromMemory(ctx, address, 10)
+	if err != nil {
+		return false
+	}
+
+	if bpoint := findBreakpointByAddress(ctx, address); bpoint != nil {
+		code[0] = bpoint.originalInstruction[0]
+	}
+
+	offset := 0
+	if code[0] == 0xb8 {
+		// mov $0x0,%eax before calling a function declared without a prototype
+		offset = 5
+	}
+	if code[offset] != 0xe8 {
+		return false
+	}
+
+	relativeTarget := int32(binary.LittleEndian.Uint32(code[offset+1 : offset+5]))
+	target := address + uint64(offset+5) + uint64(int64(relativeTarget))
+
+	function := ctx.dwarfData.PCToFunc(target)
+	return function != nil && function.Name() == COUNTER_FN
+}
+
+// Runs the target counter by counter up to the requested counter, and reports the counter of the line executed
+// before the one it ends up at, 0 if there is none. Over calls, the line is the previous one of the same function,
+// or the calling line when the function is at its first line
+func findPreviousLine(ctx *processContext, sampling command.LineSampling) (exited bool, err error) {
+	samples, frame, exited, err := sampleFrames(ctx, sampling.Counter)
+
+	previous := 0
+
+	if !exited && err == nil && len(samples) > 1 {
+		for index := len(samples) - 2; index >= 0; index-- {
+			sample := samples[index]
+
+			if sample.line <= 0 {
+				continue
+			}
+			// frames of callees lie below the frame of the function
+			if sampling.OverCalls && sample.baseAddress < frame.baseAddress {
+				continue
+			}
+
+			previous = sample.counter
+			break
+		}
+	}
+
+	reportCounter(ctx, &command.Command{NodeId: ctx.nodeData.id, Code: command.Retrieve, Argument: int32(previous)})
+
+	return exited, err
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"debug/elf"
+	"sort"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/nodeDebugger/proc"
+)
+
+// The functions of an elf file mapped into the target, sorted by address, and its loadable segments
+type symbolTable struct {
+	functions []elf.Symbol
+	segments  []elf.ProgHeader
+}
+
+// Symbol tables of the files mapped into the target, by path. Files that cannot be read have an empty table
+var symbolTables = map[string]*symbolTable{}
+
+// Names the function at the address from the symbol table of the file mapped there, for code without debug information
+// like the mpi library. Returns an empty name if the address is not in a function of a symbol table
+func symbolName(ctx *processContext, address uint64) string {
+	path, fileOffset, ok := proc.MappedFile(ctx.pid, address)
+	if !ok {
+		return ""
+	}
+
+	table := loadSymbolTable(path)
+
+	// the address the symbols of the file refer to
+	var fileAddress uint64
+	found := false
+	for _, segment := range table.segments {
+		if fileOffset >= segment.Off && fileOffset < segment.Off+segment.Filesz {
+			fileAddress = fileOffset - segment.Off + segment.Vaddr
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ""
+	}
+
+	index := sort.Search(len(table.functions), func(i int) bool {
+		return table.functions[i].Value > fileAddress
+	}) - 1
+
+	if index < 0 {
+		return ""
+	}
+	function := table.functions[index]
+	if function.Size != 0 && fileAddress >= function.Value+function.Size {
+		return ""
+	}
+	return function.Name
+}
+
+func loadSymbolTable(path string) *symbolTable {
+	if table, ok := symbolTables[path]; ok {
+		return table
+	}
+
+	table := &symbolTable{}
+	symbolTables[path] = table
+
+	file, err := elf.Open(path)
+	if err != nil {
+		logger.Debug("cannot read symbols of %v: %v", path, err)
+		return table
+	}
+	defer file.Close()
+
+	for _, program := range file.Progs {
+		if program.Type == elf.PT_LOAD {
+			table.segments = append(table.segments, program.ProgHeader)
+		}
+	}
+
+	// stripped libraries keep the dynamic symbols only
+	symbols, _ := file.Symbols()
+	dynamicSymbols, _ := file.DynamicSymbols()
+
+	for _, symbol := range append(symbols, dynamicSymbols...) {
+		if elf.ST_TYPE(symbol.Info) == elf.STT_FUNC && symbol.Value != 0 {
+			table.functions = append(table.functions, symbol)
+		}
+	}
+	sort.Slice(table.functions, func(i, j int) bool {
+		return table.functions[i].Value < table.functions[j].Value
+	})
+
+	return table
+}
@@ -8,19 +8,19 @@ import (
 	"github.com/mihkeltiks/rev-mpi-deb/logger"
 )
 
-func precleanup() {
+func precleanup(tempDir string) {
 	// remove  artefacts from previous run
-	removeTempFiles()
+	removeTempFiles(tempDir)
 }
 
-func removeTempFiles() {
+func removeTempFiles(tempDir string) {
 	logger.Debug("removing temporary files..")
 
-	dir, _ := ioutil.ReadDir("bin/temp")
+	dir, _ := ioutil.ReadDir(tempDir)
 
 	for _, d := range dir {
 		if d.Name() != ".gitkeep" {
-			os.Remove(path.Join("bin/temp", d.Name()))
+			os.Remove(path.Join(tempDir, d.Name()))
 		}
 	}
 }
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/mihkeltiks/rev-mpi-deb/nodeDebugger/dwarf"
+)
+
+// arrays print at most this many elements
+const maxPrintedElements = 200
+
+// nested structs and arrays print their contents down to this depth
+const maxPrintDepth = 8
+
+// The value of an expression: an object in the memory of the target, or a value computed by the debugger
+type targetValue struct {
+	dataType *dwarf.Type
+	address  uint64 // where the object lies in the target, 0 for computed values
+	data     []byte // contents of computed values
+}
+
+// The contents of the value, read from the target for objects in its memory
+func (v targetValue) contents(ctx *processContext) ([]byte, error) {
+	if v.address == 0 {
+		return v.data, nil
+	}
+	return peekDataFromMemory(ctx, v.address, v.dataType.ByteSize())
+}
+
+// Describes the value, reading arrays in the memory of the target up to the elements printed
+func formatValue(ctx *processContext, value targetValue) (string, error) {
+	if value.address == 0 {
+		return formatData(ctx, value.data, value.dataType, 0), nil
+	}
+
+	size := value.dataType.ByteSize()
+
+	if resolved := value.dataType.Resolved(); resolved.Kind() == dwarf.KindArray {
+		if printed := maxPrintedElements * resolved.Elem().ByteSize(); printed < size {
+			size = printed
+		}
+	}
+
+	data, err := peekDataFromMemory(ctx, value.address, size)
+	if err != nil {
+		return "", err
+	}
+	return formatData(ctx, data, value.dataType, 0), nil
+}
+
+// Decodes a value of the type: numbers, booleans and pointers as Go values, structs, unions and arrays as their contents
+func decodeValue(data []byte, dataType *dwarf.Type) interface{} {
+	resolved := dataType.Resolved()
+
+	switch resolved.Kind() {
+	case dwarf.KindBase, dwarf.KindEnum:
+		return decodeBase(data, resolved)
+	case dwarf.KindPointer:
+		if len(data) < 8 {
+			return nil
+		}
+		return binary.LittleEndian.Uint64(data)
+	}
+
+	return formatData(nil, data, dataType, 0)
+}
+
+// Decodes a value of a base type, or of an enum, by its encoding. Nil for sizes and encodings not handled
+func decodeBase(data []byte, dataType *dwarf.Type) interface{} {
+	size := dataType.ByteSize()
+
+	if int64(len(data)) < size {
+		return nil
+	}
+
+	switch dataType.Encoding() {
+	case dwarf.EncodingFloat:
+		switch size {
+		case 4:
+			return math.Float32frombits(binary.LittleEndian.Uint32(data))
+		case 8:
+			return math.Float64frombits(binary.LittleEndian.Uint64(data))
+		case 16:
+			return extendedToFloat64(data)
+		}
+
+	case dwarf.EncodingBoolean:
+		for _, b := range data[:size] {
+			if b != 0 {
+				return true
+			}
+		}
+		return false
+
+	case dwarf.EncodingSigned, dwarf.EncodingSignedChar:
+		switch size {
+		case 1:
+			return int8(data[0])
+		case 2:
+			return int16(binary.LittleEndian.Uint16(data))
+		case 4:
+			return int32(binary.LittleEndian.Uint32(data))
+		case 8:
+			return int64(binary.LittleEndian.Uint64(data))
+		}
+
+	case dwarf.EncodingUnsigned, dwarf.EncodingUnsignedChar:
+		switch size {
+		case 1:
+			return data[0]
+		case 2:
+			return binary.LittleEndian.Uint16(data)
+		case 4:
+			return binary.LittleEndian.Uint32(data)
+		case 8:
+			return binary.LittleEndian.Uint64(data)
+		}
+	}
+
+	return nil
+}
+
+// Converts an x87 80-bit extended precision number, as long double is stored on x86-64, to the closest float64
+func extendedToFloat64(data []byte) float64 {
+	mantissa := binary.LittleEndian.Uint64(data[0:8])
+	signAndExponent := binary.LittleEndian.Uint16(data[8:10])
+
+	sign := 1.0
+	if signAndExponent&0x8000 != 0 {
+		sign = -1
+	}
+	exponent := int(signAndExponent & 0x7fff)
+
+	switch {
+	case exponent == 0 && mantissa == 0:
+		return math.Copysign(0, sign)
+	case exponent == 0x7fff && mantissa<<1 == 0:
+		return math.Inf(int(sign))
+	case exponent == 0x7fff:
+		return math.NaN()
+	}
+
+	// the mantissa has an explicit integer bit, and the exponent a bias of 16383
+	return sign * math.Ldexp(float64(mantissa), exponent-16383-63)
+}
+
+// Whether the type is a C character type, which arrays of and pointers to print as strings
+func isCharType(dataType *dwarf.Type) bool {
+	if dataType == nil {
+		return false
+	}
+	resolved := dataType.Resolved()
+	encoding := resolved.Encoding()
+
+	return resolved.Kind() == dwarf.KindBase && resolved.ByteSize() == 1 &&
+		(encoding == dwarf.EncodingSignedChar || encoding == dwarf.EncodingUnsignedChar)
+}
+
+// Describes a value of the type as C would initialize it, like {x = 1, y = {2.5, 3}, name = "abc"}.
+// Strings char pointers point to are read from the target, unless ctx is nil
+func formatData(ctx *processContext, data []byte, dataType *dwarf.Type, depth int) string {
+	resolved := dataType.Resolved()
+
+	if resolved.Kind() != dwarf.KindArray && int64(len(data)) < resolved.ByteSize() {
+		return "<unreadable>"
+	}
+
+	switch resolved.Kind() {
+	case dwarf.KindBase:
+		switch value := decodeBase(data, resolved).(type) {
+		case nil:
+			return fmt.Sprintf("<%d byte %v>", resolved.ByteSize(), resolved.Name())
+		case float32:
+			return strconv.FormatFloat(float64(value), 'g', -1, 32)
+		case float64:
+			return strconv.FormatFloat(value, 'g', -1, 64)
+		default:
+			if isCharType(resolved) {
+				return fmt.Sprintf("%v '%v'", value, escapeChar(data[0], '\''))
+			}
+			return fmt.Sprint(value)
+		}
+
+	case dwarf.KindEnum:
+		value := decodeBase(data, resolved)
+		for _, enumerator := range resolved.Enumerators() {
+			if fmt.Sprint(enumerator.Value) == fmt.Sprint(value) {
+				return enumerator.Name
+			}
+		}
+		return fmt.Sprint(value)
+
+	case dwarf.KindPointer:
+		pointer := binary.LittleEndian.Uint64(data)
+
+		if ctx != nil && pointer != 0 && isCharType(resolved.Elem()) {
+			return fmt.Sprintf("%#x %v", pointer, readCString(ctx, pointer))
+		}
+		return fmt.Sprintf("(%v) %#x", dataType.Name(), pointer)
+
+	case dwarf.KindStruct, dwarf.KindUnion:
+		if depth >= maxPrintDepth {
+			return "{...}"
+		}
+
+		fields := []string{}
+		for _, member := range resolved.Members() {
+			start := member.Offset()
+			end := start + member.Type().ByteSize()
+			if start > int64(len(data)) {
+				start = int64(len(data))
+			}
+			if end > int64(len(data)) {
+				end = int64(len(data))
+			}
+			fields = append(fields, fmt.Sprintf("%v = %v", member.Name, formatData(ctx, data[start:end], member.Type(), depth+1)))
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+
+	case dwarf.KindArray:
+		if resolved.Count() < 0 {
+			return fmt.Sprintf("<%v of unknown length>", dataType.Name())
+		}
+		if isCharType(resolved.Elem()) {
+			return formatCharArray(data, resolved.Count())
+		}
+		if depth >= maxPrintDepth {
+			return "{...}"
+		}
+
+		element := resolved.Elem()
+		size := element.ByteSize()
+
+		elements := []string{}
+		for index := int64(0); index < resolved.Count(); index++ {
+			if index == maxPrintedElements {
+				elements = append(elements, "...")
+				break
+			}
+			start := index * size
+			if start+size > int64(len(data)) {
+				elements = append(elements, "<unreadable>")
+				break
+			}
+			elements = append(elements, formatData(ctx, data[start:start+size], element, depth+1))
+		}
+		return "{" + strings.Join(elements, ", ") + "}"
+	}
+
+	return fmt.Sprintf("<%v>", dataType.Name())
+}
+
+// Quotes the contents of a char array up to the terminating null character.
+// Arrays with more characters after it, or without one, are printed in full
+func formatCharArray(data []byte, count int64) string {
+	if int64(len(data)) > count {
+		data = data[:count]
+	}
+
+	end := bytes.IndexByte(data, 0)
+	if end < 0 || len(bytes.Trim(data[end:], "\x00")) > 0 {
+		end = len(data)
+	}
+
+	quoted := quoteCString(data[:end])
+	if count > int64(len(data)) {
+		quoted += "..."
+	}
+	return quoted
+}
+
+// Reads the null terminated string at the address, up to the characters printed
+func readCString(ctx *processContext, address uint64) string {
+	const chunkSize = 64
+
+	characters := []byte{}
+
+	for len(characters) < maxPrintedElements {
+		chunk := make([]byte, chunkSize)
+		if _, err := syscall.PtracePeekData(ctx.pid, uintptr(address)+uintptr(len(characters)), chunk); err != nil {
+			if len(characters) == 0 {
+				return fmt.Sprintf("<cannot access memory at %#x>", address)
+			}
+			break
+		}
+
+		if end := bytes.IndexByte(chunk, 0); end >= 0 {
+			return quoteCString(append(characters, chunk[:end]...))
+		}
+		characters = append(characters, chunk...)
+	}
+
+	return quoteCString(characters) + "..."
+}
+
+func quoteCString(characters []byte) string {
+	var quoted strings.Builder
+
+	quoted.WriteByte('"')
+	for _, c := range characters {
+		quoted.WriteString(escapeChar(c, '"'))
+	}
+	quoted.WriteByte('"')
+
+	return quoted.String()
+}
+
+// Writes the character as in a C literal quoted with the quote, non-printable ones as escapes
+func escapeChar(c byte, quote byte) string {
+	switch c {
+	case quote, '\\':
+		return "\\" + string(c)
+	case '\n':
+		return "\\n"
+	case '\t':
+		return "\\t"
+	case '\r':
+		return "\\r"
+	}
+	if c < ' ' || c > '~' {
+		return fmt.Sprintf("\\%03o", c)
+	}
+	return string(c)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/nodeDebugger/dwarf"
+	"github.com/mihkeltiks/rev-mpi-deb/rpc"
+	"github.com/mihkeltiks/rev-mpi-deb/utils"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// Hardware watchpoints use the x86-64 debug registers: DR0-DR3 hold the watched addresses,
+// DR7 enables them and sets the access and length watched, DR6 tells which one triggered
+
+// offset of u_debugreg in struct user (sys/user.h)
+const debugRegisterOffset = 848
+
+const debugStatusRegister = 6
+const debugControlRegister = 7
+
+// watchpoints by the debug register holding their address
+type watchpointSlots [4]*watchpointData
+
+type watchpointData struct {
+	slot     int
+	address  uint64
+	variable *dwarf.Variable
+	value    []byte             // contents of the watched memory when last checked
+	spec     command.Breakpoint // variable, access, condition and ignore count as set by the user
+	frame    uint64             // canonical frame address of the frame of a watched local, 0 for globals
+	scope    *bpointData        // breakpoint at the return address of the frame, deleting the watchpoint when the frame returns
+}
+
+func peekDebugRegister(ctx *processContext, register int) (uint64, error) {
+	var value uint64
+
+	_, _, errno := syscall.Syscall6(
+		syscall.SYS_PTRACE, syscall.PTRACE_PEEKUSR, uintptr(ctx.pid),
+		uintptr(debugRegisterOffset+register*8), uintptr(unsafe.Pointer(&value)), 0, 0,
+	)
+	if errno != 0 {
+		return 0, errno
+	}
+	return value, nil
+}
+
+func pokeDebugRegister(ctx *processContext, register int, value uint64) error {
+	_, _, errno := syscall.Syscall6(
+		syscall.SYS_PTRACE, syscall.PTRACE_POKEUSR, uintptr(ctx.pid),
+		uintptr(debugRegisterOffset+register*8), uintptr(value), 0, 0,
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// The DR7 bits enabling a watchpoint in the slot: the local enable bit, and the access and length fields
+func debugControlBits(slot int, access command.WatchAccess, size int64) (bits uint64, mask uint64) {
+	// x86 has no read-only watchpoints, reads are told apart from writes by the value
+	accessBits := uint64(0b11)
+	if access == command.WatchWrite {
+		accessBits = 0b01
+	}
+
+	lengthBits := map[int64]uint64{1: 0b00, 2: 0b01, 4: 0b11, 8: 0b10}[size]
+
+	mask = 1<<(2*slot) | 0b1111<<(16+4*slot)
+	bits = 1<<(2*slot) | accessBits<<(16+4*slot) | lengthBits<<(18+4*slot)
+
+	return bits, mask
+}
+
+func findWatchpointById(ctx *processContext, id int) *watchpointData {
+	for _, watchpoint := range ctx.watchpoints {
+		if watchpoint != nil && watchpoint.spec.Id == id {
+			return watchpoint
+		}
+	}
+	return nil
+}
+
+func setWatchpoint(ctx *processContext, spec command.Breakpoint) error {
+	if spec.Id != 0 {
+		if existing := findWatchpointById(ctx, spec.Id); existing != nil && existing.spec.Watch == spec.Watch {
+			// only the settings change
+			spec.WatchFrame = existing.spec.WatchFrame
+			existing.spec = spec
+			return nil
+		}
+	}
+
+	frame := ctx.stack.frame(ctx.selectedFrame)
+	if spec.WatchFrame != 0 {
+		// set again after a restore or a replay, in the frame of the variable
+		ctx.stack = getStack(ctx)
+		if frame = ctx.stack.frameAt(spec.WatchFrame); frame == nil {
+			return fmt.Errorf("cannot watch %v: its frame at %#x is not on the call stack", spec.Watch, spec.WatchFrame)
+		}
+	}
+
+	variable, address, variableFrame := lookupVariableInFrame(ctx, spec.Watch, frame, true)
+	if variable == nil {
+		return fmt.Errorf("cannot watch %v: variable not found", spec.Watch)
+	}
+
+	size := variable.ByteSize()
+	if size != 1 && size != 2 && size != 4 && size != 8 {
+		return fmt.Errorf("cannot watch %v: hardware watchpoints cover 1, 2, 4 or 8 bytes, the variable has %d", spec.Watch, size)
+	}
+	if address%uint64(size) != 0 {
+		return fmt.Errorf("cannot watch %v: address %#x is not aligned to its size", spec.Watch, address)
+	}
+	value, err := peekDataFromMemory(ctx, address, size)
+	if err != nil {
+		return fmt.Errorf("cannot watch %v: %v", spec.Watch, err)
+	}
+
+	slot := -1
+	for index, watchpoint := range ctx.watchpoints {
+		if watchpoint == nil {
+			slot = index
+			break
+		}
+	}
+	if slot < 0 {
+		return fmt.Errorf("cannot watch %v: all %d debug registers are in use", spec.Watch, len(ctx.watchpoints))
+	}
+
+	control, err := peekDebugRegister(ctx, debugControlRegister)
+	if err != nil {
+		return fmt.Errorf("cannot read debug control register: %v", err)
+	}
+
+	bits, mask := debugControlBits(slot, spec.Access, size)
+
+	if err := pokeDebugRegister(ctx, slot, address); err != nil {
+		return fmt.Errorf("cannot set debug register %d: %v", slot, err)
+	}
+	if err := pokeDebugRegister(ctx, debugControlRegister, control&^mask|bits); err != nil {
+		return fmt.Errorf("cannot set debug control register: %v", err)
+	}
+
+	watchpoint := &watchpointData{
+		slot:     slot,
+		address:  address,
+		variable: variable,
+		value:    value,
+		spec:     spec,
+	}
+	ctx.watchpoints[slot] = watchpoint
+
+	logger.Info("watching %v at %#x (%d bytes)", spec.Watch, address, size)
+
+	if variableFrame != nil {
+		bindWatchpointToFrame(ctx, watchpoint, variableFrame)
+	}
+
+	return nil
+}
+
+// Binds the watchpoint on a local to the frame of the variable, which deletes it when it returns, as gdb does.
+// The frame is reported to the orchestrator, which sets the watchpoint again in the same frame after a restore
+func bindWatchpointToFrame(ctx *processContext, watchpoint *watchpointData, frame *stackFunction) {
+	watchpoint.frame = frame.canonicalFrameAddress()
+
+	if watchpoint.spec.WatchFrame == 0 {
+		watchpoint.spec.WatchFrame = watchpoint.frame
+		reportWatchpointScope(ctx, rpc.WatchpointScope{NodeId: ctx.nodeData.id, BreakpointId: watchpoint.spec.Id, Frame: watchpoint.frame})
+	}
+
+	// main returns only as the program exits, other breakpoints at the return address are checked at the next stop
+	if frame.name() == MAIN_FN || frame.returnAddress == 0 || findBreakpointByAddress(ctx, frame.returnAddress) != nil {
+		return
+	}
+
+	watchpoint.scope = insertReturnBreakpoint(ctx, frame.returnAddress, frame.baseAddress)
+	watchpoint.scope.watchScope = watchpoint
+}
+
+// Deletes the watchpoint on a local whose frame returned, as the variable no longer exists
+func leaveWatchpointScope(ctx *processContext, watchpoint *watchpointData) {
+	logger.Info("Watchpoint %v deleted because the program has left the block in which %v is valid", watchpoint.spec.Id, watchpoint.spec.Watch)
+
+	removeWatchpoint(ctx, watchpoint)
+	reportWatchpointScope(ctx, rpc.WatchpointScope{NodeId: ctx.nodeData.id, BreakpointId: watchpoint.spec.Id})
+}
+
+// Deletes the watchpoints on locals whose frames are no longer on the call stack, returned while the target was stepping
+func deleteWatchpointsOutOfScope(ctx *processContext) {
+	if !ctx.stack.complete() {
+		return
+	}
+
+	for _, watchpoint := range ctx.watchpoints {
+		if watchpoint != nil && watchpoint.frame != 0 && ctx.stack.frameAt(watchpoint.frame) == nil {
+			leaveWatchpointScope(ctx, watchpoint)
+		}
+	}
+}
+
+func removeWatchpoint(ctx *processContext, watchpoint *watchpointData) {
+	control, err := peekDebugRegister(ctx, debugControlRegister)
+	if err == nil {
+		_, mask := debugControlBits(watchpoint.slot, watchpoint.spec.Access, watchpoint.variable.ByteSize())
+		err = pokeDebugRegister(ctx, debugControlRegister, control&^mask)
+	}
+	if err != nil {
+		logger.Warn("cannot clear debug register %d: %v", watchpoint.slot, err)
+	}
+
+	// the breakpoint is gone already if the target stopped at it
+	if scope := watchpoint.scope; scope != nil && ctx.bpointData[scope.address] == scope {
+		_, err := syscall.PtracePokeData(ctx.pid, uintptr(scope.address), scope.originalInstruction)
+		utils.Must(err)
+
+		delete(ctx.bpointData, scope.address)
+	}
+
+	ctx.watchpoints[watchpoint.slot] = nil
+}
+
+func removeWatchpoints(ctx *processContext) {
+	for _, watchpoint := range ctx.watchpoints {
+		if watchpoint != nil {
+			removeWatchpoint(ctx, watchpoint)
+		}
+	}
+}
+
+// Returns the watchpoint that stopped the target, if any, and clears the debug status register
+func caughtWatchpoint(ctx *processContext) *watchpointData {
+	status, err := peekDebugRegister(ctx, debugStatusRegister)
+	if err != nil || status&0b1111 == 0 {
+		return nil
+	}
+
+	pokeDebugRegister(ctx, debugStatusRegister, 0)
+
+	for slot, watchpoint := range ctx.watchpoints {
+		if watchpoint != nil && status&(1<<slot) != 0 {
+			return watchpoint
+		}
+	}
+	return nil
+}
+
+// Reads the watched memory again, keeping the last value read if it cannot be read
+func (watchpoint *watchpointData) refreshValue(ctx *processContext) {
+	if value, err := peekDataFromMemory(ctx, watchpoint.address, watchpoint.variable.ByteSize()); err == nil {
+		watchpoint.value = value
+	}
+}
+
+// Decides whether the access caught by a watchpoint stops the target, reporting the old and new values when it does
+func watchpointStops(ctx *processContext, watchpoint *watchpointData) bool {
+	oldValue := watchpoint.value
+	newValue, err := peekDataFromMemory(ctx, watchpoint.address, watchpoint.variable.ByteSize())
+	if err != nil {
+		// whether the value changed is unknown, the target stops and the last value read is kept
+		logger.Warn("Watchpoint %v: cannot read %v: %v", watchpoint.spec.Id, watchpoint.spec.Watch, err)
+		reportBreakpoint(ctx, rpc.BreakpointStop{NodeId: ctx.nodeData.id, BreakpointId: watchpoint.spec.Id})
+		return true
+	}
+	watchpoint.value = newValue
+
+	changed := !bytes.Equal(oldValue, newValue)
+
+	switch {
+	case watchpoint.spec.Access == command.WatchWrite && !changed:
+		return false
+	case watchpoint.spec.Access == command.WatchRead && changed:
+		// a write, the debug registers do not tell them apart from reads
+		return false
+	case !conditionHolds(ctx, watchpoint.spec.Condition):
+		return false
+	case watchpoint.spec.IgnoreCount > 0:
+		watchpoint.spec.IgnoreCount--
+		reportBreakpointHit(ctx, watchpoint.spec.Id, true)
+		return false
+	}
+
+	regs := getRegs(ctx, false)
+	line, file, _, _ := ctx.dwarfData.PCToLine(regs.Rip)
+
+	if changed {
+		logger.Info(
+			"Watchpoint %v: %v changed at line %d in %v, old value: %v, new value: %v",
+			watchpoint.spec.Id, watchpoint.spec.Watch, line, filepath.Base(file),
+			convertValueToType(oldValue, watchpoint.variable), convertValueToType(newValue, watchpoint.variable),
+		)
+	} else {
+		logger.Info(
+			"Watchpoint %v: %v accessed at line %d in %v, value: %v",
+			watchpoint.spec.Id, watchpoint.spec.Watch, line, filepath.Base(file), convertValueToType(newValue, watchpoint.variable),
+		)
+	}
+
+	reportBreakpointHit(ctx, watchpoint.spec.Id, false)
+	reportBreakpoint(ctx, rpc.BreakpointStop{NodeId: ctx.nodeData.id, BreakpointId: watchpoint.spec.Id})
+
+	return true
+}
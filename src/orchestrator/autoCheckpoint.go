@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/checkpoint-restore/go-criu/v7"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/orchestrator/checkpointmanager"
+	nodeconnection "github.com/mihkeltiks/rev-mpi-deb/orchestrator/nodeConnection"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// mpi calls reported by the nodes
+var mpiEventCount atomic.Int64
+
+// Held while the job is driven by a command or an automatic checkpoint, which take turns
+var jobMutex sync.Mutex
+
+// Forward execution since the checkpoint last taken or restored
+var forwardExecution struct {
+	duration  time.Duration
+	mpiEvents int64
+}
+
+// How often the supervisor of automatic checkpoints checks the thresholds of the policy
+const supervisionInterval = 100 * time.Millisecond
+
+// How long the supervisor waits for the ranks to stop for a checkpoint before resuming them without one
+const interruptTimeout = 5 * time.Second
+
+func resetForwardExecution() {
+	forwardExecution.duration = 0
+	forwardExecution.mpiEvents = 0
+}
+
+// Whether a threshold of the automatic checkpoint policy is set
+func autoCheckpointing() bool {
+	return config.AutoCheckpointSeconds > 0 || config.AutoCheckpointMpiEvents > 0 || config.AutoCheckpointStatements > 0
+}
+
+// Continues the nodes. Nodes not running a command are supervised: the supervisor interrupts their continue
+// for automatic checkpoints and resumes it, so the continue of the user runs on as if not interrupted
+func continueSupervised(cmd *command.Command) {
+	nodeIds := nodeconnection.TargetNodeIds(cmd)
+
+	supervised := []int{}
+	if autoCheckpointing() {
+		supervised = nodeconnection.SuperviseNodes(nodeIds)
+		if config.AutoCheckpointStatements > 0 {
+			setStatementTargets(supervised, retrieveNodeCounters(supervised))
+		}
+	}
+
+	for _, nodeId := range nodeIds {
+		nodeCmd := &command.Command{NodeId: nodeId, Code: command.Cont}
+		if slices.Contains(supervised, nodeId) {
+			nodeCmd.Argument = command.SupervisedCont
+		}
+		nodeconnection.HandleRemotely(nodeCmd)
+	}
+
+	// the supervisor takes its checkpoints while the continue runs
+	jobMutex.Unlock()
+	awaitCommandResults(nodeIds)
+	jobMutex.Lock()
+}
+
+// Checks the thresholds of the policy while supervised continues run, and interrupts them for a checkpoint when one is passed
+func superviseAutoCheckpoints(c *criu.Criu) {
+	lastTick := time.Now()
+	lastMpiEvents := mpiEventCount.Load()
+
+	for {
+		time.Sleep(supervisionInterval)
+
+		jobMutex.Lock()
+
+		running, interrupted := nodeconnection.SupervisedNodes()
+
+		// only execution during supervised continues counts, not the pauses at the prompt
+		mpiEvents := mpiEventCount.Load()
+		if len(running) > 0 || len(interrupted) > 0 {
+			forwardExecution.duration += time.Since(lastTick)
+			forwardExecution.mpiEvents += mpiEvents - lastMpiEvents
+		}
+		lastTick = time.Now()
+		lastMpiEvents = mpiEvents
+
+		// ranks stopped at their counter targets have run the statements of the policy
+		reason := ""
+		if len(interrupted) > 0 {
+			reason = fmt.Sprintf("%d statements on rank %d", config.AutoCheckpointStatements, nodeconnection.RankOfNode(interrupted[0]))
+		} else if len(running) > 0 {
+			reason = autoCheckpointReason()
+		}
+
+		if reason != "" {
+			takeAutomaticCheckpoint(c, reason)
+		}
+
+		jobMutex.Unlock()
+	}
+}
+
+// Interrupts the supervised continues, checkpoints the job and resumes them. Ranks running other commands,
+// or exited ranks, cannot be checkpointed, the ranks are then resumed without a checkpoint
+func takeAutomaticCheckpoint(c *criu.Criu, reason string) {
+	checkpointable := nodeconnection.GetRegisteredNodesLen() == numProcesses && nodeconnection.OnlySupervisedCommandsRunning()
+
+	if checkpointable && !interruptSupervisedNodes() {
+		logger.Verbose("ranks did not stop for an automatic checkpoint in %v", interruptTimeout)
+		checkpointable = false
+	}
+
+	_, interrupted := nodeconnection.SupervisedNodes()
+
+	if checkpointable {
+		if counters := retrieveCounters(); slices.Equal(counters, currentCheckpointTree.GetCounters()) {
+			// ranks waiting in mpi calls have not moved since the last checkpoint
+			resetForwardExecution()
+		} else {
+			logger.Info("taking an automatic checkpoint after %v", reason)
+
+			takeCheckpoint(c, checkpointBranch())
+			currentCheckpointTree.SetAutomatic(true)
+
+			if config.CheckpointBudget > 0 {
+				thinAutomaticCheckpoints(int64(config.CheckpointBudget) << 20)
+			}
+		}
+	}
+
+	if config.AutoCheckpointStatements > 0 {
+		setStatementTargets(interrupted, retrieveNodeCounters(interrupted))
+	}
+	for _, nodeId := range interrupted {
+		// the continue goes on after the checkpoint
+		currentCommandlog = append(currentCommandlog, command.Command{NodeId: nodeId, Code: command.Cont})
+		nodeconnection.ResumeRemotely(nodeId)
+	}
+}
+
+// Interrupts the running supervised continues, and waits until each is interrupted or has ended by itself.
+// Returns false if some did not stop in time
+func interruptSupervisedNodes() bool {
+	deadline := time.Now().Add(interruptTimeout)
+	signalled := map[int]bool{}
+
+	for time.Now().Before(deadline) {
+		running, _ := nodeconnection.SupervisedNodes()
+		if len(running) == 0 {
+			return true
+		}
+
+		for _, nodeId := range running {
+			// a node just starting or ending its continue cannot be interrupted, it is tried again
+			if !signalled[nodeId] {
+				signalled[nodeId] = nodeconnection.InterruptRemotely(nodeId, command.Stop)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+// Sets the statement counter targets of the nodes, so that they stop for a checkpoint
+// once they have run the statements of the policy since the current checkpoint
+func setStatementTargets(nodeIds []int, counters map[int]int) {
+	checkpointCounters := currentCheckpointTree.GetCounters()
+
+	for _, nodeId := range nodeIds {
+		target := counters[nodeId] + config.AutoCheckpointStatements
+		if nodeId < len(checkpointCounters) && checkpointCounters[nodeId]+config.AutoCheckpointStatements > counters[nodeId] {
+			target = checkpointCounters[nodeId] + config.AutoCheckpointStatements
+		}
+		nodeconnection.HandleRemotely(&command.Command{NodeId: nodeId, Code: command.Insert, Argument: target})
+	}
+}
+
+// Returns the current statement counters of the nodes, which are not running a command
+func retrieveNodeCounters(nodeIds []int) map[int]int {
+	for _, nodeId := range nodeIds {
+		nodeconnection.SetNodeCounter(nodeId, -1)
+		nodeconnection.HandleRemotely(&command.Command{NodeId: nodeId, Code: command.Retrieve, Argument: "counter"})
+	}
+
+	counters := map[int]int{}
+	for _, nodeId := range nodeIds {
+		for nodeconnection.GetNodeCounter(nodeId) == -1 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		counters[nodeId] = nodeconnection.GetNodeCounter(nodeId)
+	}
+	return counters
+}
+
+// Describes the threshold of time or mpi calls passed since the last checkpoint, empty if none is.
+// Ranks passing the threshold of statements stop at their counter targets by themselves
+func autoCheckpointReason() string {
+	if config.AutoCheckpointSeconds > 0 && forwardExecution.duration >= time.Duration(config.AutoCheckpointSeconds)*time.Second {
+		return forwardExecution.duration.Round(time.Second).String() + " of execution"
+	}
+
+	if config.AutoCheckpointMpiEvents > 0 && forwardExecution.mpiEvents >= int64(config.AutoCheckpointMpiEvents) {
+		return fmt.Sprintf("%d mpi calls", forwardExecution.mpiEvents)
+	}
+
+	return ""
+}
+
+// Removes automatic checkpoints until the images of the session fit in the budget, in bytes.
+// Checkpoints are thinned out logarithmically: the further back a checkpoint lies from the latest one of its branch,
+// the further apart the checkpoints around it are left, so replays from recent points stay short.
+// Labelled checkpoints, those branches fork from and the latest one of each branch are kept
+func thinAutomaticCheckpoints(budget int64) {
+	for checkpointImagesSize() > budget {
+		candidate := thinningCandidate()
+		if candidate == nil {
+			logger.Warn("checkpoint images exceed the budget of %d MB, no automatic checkpoint is left to remove", budget>>20)
+			return
+		}
+
+		logger.Verbose("thinned out automatic checkpoint %d", removeCheckpoint(candidate))
+	}
+}
+
+// The automatic checkpoint whose removal leaves the smallest gap relative to its distance from the latest checkpoint of its branch
+func thinningCandidate() *checkpointmanager.CheckpointTree {
+	var candidate *checkpointmanager.CheckpointTree
+	var candidateScore float64
+
+	var visit func(tree *checkpointmanager.CheckpointTree)
+	visit = func(tree *checkpointmanager.CheckpointTree) {
+		children := tree.GetChildrenTrees()
+		for _, child := range children {
+			visit(child)
+		}
+
+		if !tree.IsAutomatic() || tree.GetLabel() != "" || tree == currentCheckpointTree || len(children) != 1 {
+			return
+		}
+		next := children[0]
+		if next.GetBranch() != tree.GetBranch() {
+			return
+		}
+
+		tip := checkpointmanager.FindBranchTip(&rootCheckpointTree, tree.GetBranch())
+		age := executionPosition(tip) - executionPosition(tree)
+		gap := executionPosition(next) - executionPosition(tree.GetParentTree())
+
+		score := float64(gap) / float64(max(age, 1))
+		if candidate == nil || score < candidateScore {
+			candidate = tree
+			candidateScore = score
+		}
+	}
+	visit(&rootCheckpointTree)
+
+	return candidate
+}
+
+// How far the job had run when the checkpoint was taken: the statements executed by all ranks
+func executionPosition(tree *checkpointmanager.CheckpointTree) int {
+	position := 0
+	for _, counter := range tree.GetCounters() {
+		position += counter
+	}
+	return position
+}
+
+// The size of the checkpoint images of the session, in bytes
+func checkpointImagesSize() int64 {
+	var size int64
+
+	for _, dir := range checkpoints {
+		if dir == "" {
+			continue
+		}
+		filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info, err := entry.Info(); err == nil && !entry.IsDir() {
+				size += info.Size()
+			}
+			return nil
+		})
+	}
+
+	return size
+}
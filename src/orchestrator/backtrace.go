@@ -0,0 +1,36 @@
+package main
+
+import (
+	"time"
+
+	nodeconnection "github.com/mihkeltiks/rev-mpi-deb/orchestrator/nodeConnection"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// How long the orchestrator waits for the call stacks of the nodes
+const backtraceTimeout = 2 * time.Second
+
+// Collects the call stacks of the nodes. Nodes running a command, like a rank blocked in an mpi call waiting for another one,
+// are interrupted to report theirs and then run on. Nodes not reporting in time are left without a call stack
+func collectBacktraces(nodeIds []int) {
+	nodeconnection.ResetBacktraces()
+
+	for _, nodeId := range nodeIds {
+		if !nodeconnection.InterruptRemotely(nodeId, command.Backtrace) {
+			nodeconnection.HandleRemotely(&command.Command{NodeId: nodeId, Code: command.Backtrace})
+		}
+	}
+
+	deadline := time.Now().Add(backtraceTimeout)
+	for time.Now().Before(deadline) {
+		reported := true
+		for _, nodeId := range nodeIds {
+			reported = reported && nodeconnection.GetBacktrace(nodeId) != nil
+		}
+		if reported {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/checkpoint-restore/go-criu/v7"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/orchestrator/checkpointmanager"
+	nodeconnection "github.com/mihkeltiks/rev-mpi-deb/orchestrator/nodeConnection"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// Whether variables were changed since the checkpoint last taken or restored. Replays start from checkpoints
+// and do not repeat the changes, so the job is checkpointed with them before it runs on
+var variablesChanged bool
+
+// Checkpoints the job with the variables changed at its current stop before it runs forward,
+// so that replays of the patched run start from the changed state
+func checkpointChangedVariables(c *criu.Criu) {
+	if !variablesChanged {
+		return
+	}
+
+	// exited ranks cannot be checkpointed
+	if nodeconnection.GetRegisteredNodesLen() < numProcesses {
+		logger.Warn("cannot checkpoint the changed variables after a rank exited, replays go back to the unchanged run")
+		variablesChanged = false
+		return
+	}
+
+	logger.Info("checkpointing the changed variables, replays of this run start from them")
+	takeCheckpoint(c, checkpointBranch())
+}
+
+// Records the current state of the job as a new branch, forked from the checkpoint last taken or restored.
+// Used after restoring a checkpoint and changing variables, to keep what happens next apart from the original run
+func createBranch(c *criu.Criu, name string) {
+	if checkpointmanager.FindBranchTip(&rootCheckpointTree, name) != nil {
+		logger.Warn("branch %v already exists", name)
+		return
+	}
+
+	forkedFrom := currentCheckpointTree
+	takeCheckpoint(c, name)
+
+	logger.Info("recorded branch %v as checkpoint %d, forked from checkpoint %d on %v",
+		name, checkpointIndex(currentCheckpointTree.GetCheckpointDir()), checkpointIndex(forkedFrom.GetCheckpointDir()), forkedFrom.GetBranch())
+}
+
+// Restores the latest checkpoint of the branch, further checkpoints continue it
+func switchBranch(name string) {
+	tip := checkpointmanager.FindBranchTip(&rootCheckpointTree, name)
+	if tip == nil {
+		logger.Warn("no branch %v", name)
+		return
+	}
+
+	restoreCheckpointTree(tip)
+	logger.Info("switched to branch %v at checkpoint %d", name, checkpointIndex(tip.GetCheckpointDir()))
+}
+
+func printBranches() {
+	for _, name := range checkpointmanager.ListBranches(&rootCheckpointTree) {
+		path := checkpointmanager.BranchCheckpoints(&rootCheckpointTree, name)
+		tip := path[len(path)-1]
+
+		marker := " "
+		if name == currentBranch {
+			marker = "*"
+		}
+
+		description := fmt.Sprintf("tip checkpoint %d, counters %v", checkpointIndex(tip.GetCheckpointDir()), describeCounters(tip.GetCounters()))
+		if forkPoint := path[0]; forkPoint.GetBranch() != name {
+			description = fmt.Sprintf("forked from %v at checkpoint %d, %v", forkPoint.GetBranch(), checkpointIndex(forkPoint.GetCheckpointDir()), description)
+		}
+
+		fmt.Printf("%v %-12v %v\n", marker, name, description)
+	}
+
+	if currentBranch == "" {
+		fmt.Printf("  off any branch since restoring checkpoint %d\n", checkpointIndex(currentCheckpointTree.GetCheckpointDir()))
+	}
+}
+
+// Prints where two branches diverged, the statement counters of each rank at their tips,
+// and the commands executed on each since they diverged
+func compareBranches(first, second string) {
+	tips := []*checkpointmanager.CheckpointTree{}
+	for _, name := range []string{first, second} {
+		tip := checkpointmanager.FindBranchTip(&rootCheckpointTree, name)
+		if tip == nil {
+			logger.Warn("no branch %v", name)
+			return
+		}
+		tips = append(tips, tip)
+	}
+
+	forkPoint := checkpointmanager.ForkPoint(tips[0], tips[1])
+	fmt.Printf("%v and %v diverge after checkpoint %d\n", first, second, checkpointIndex(forkPoint.GetCheckpointDir()))
+
+	fmt.Printf("  %-6v %12v %12v\n", "rank", first, second)
+	for nodeId := range tips[0].GetCounters() {
+		firstCounter := tips[0].GetCounters()[nodeId]
+		secondCounter := -1
+		if nodeId < len(tips[1].GetCounters()) {
+			secondCounter = tips[1].GetCounters()[nodeId]
+		}
+
+		marker := ""
+		if firstCounter != secondCounter {
+			marker = " *"
+		}
+		fmt.Printf("  %-6v %12v %12v%v\n", nodeconnection.RankOfNode(nodeId), firstCounter, secondCounter, marker)
+	}
+
+	for index, name := range []string{first, second} {
+		commands := describeCommands(checkpointmanager.CommandsSince(forkPoint, tips[index]))
+		if commands == "" {
+			commands = "none"
+		}
+		fmt.Printf("commands on %v: %v\n", name, commands)
+	}
+}
+
+// The ranks a logged command was addressed to, as entered
+func commandRanks(cmd command.Command) string {
+	if cmd.NodeId == command.AllNodes {
+		return "all"
+	}
+
+	ranks := []string{}
+	for _, nodeId := range nodeconnection.TargetNodeIds(&cmd) {
+		ranks = append(ranks, fmt.Sprint(nodeconnection.RankOfNode(nodeId)))
+	}
+	return strings.Join(ranks, ",")
+}
+
+// An unused name for a branch forked from the branch
+func newBranchName(forkedFrom string) string {
+	for number := 1; ; number++ {
+		name := fmt.Sprintf("%v-%d", forkedFrom, number)
+		if checkpointmanager.FindBranchTip(&rootCheckpointTree, name) == nil {
+			return name
+		}
+	}
+}
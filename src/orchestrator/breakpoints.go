@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	nodeconnection "github.com/mihkeltiks/rev-mpi-deb/orchestrator/nodeConnection"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// Numbers a new breakpoint in the breakpoint table and sets it on the addressed nodes
+func setBreakpoint(cmd *command.Command) {
+	entry := nodeconnection.AddBreakpointEntry(cmd.Argument.(command.Breakpoint), nodeconnection.TargetNodeIds(cmd))
+
+	logger.Info("breakpoint %d at %v", entry.Id, entry.Spec)
+
+	for _, nodeId := range entry.NodeIds {
+		nodeconnection.HandleRemotely(&command.Command{NodeId: nodeId, Code: command.Bpoint, Argument: entry.NodeSpec(nodeId)})
+	}
+	awaitCommandResults(entry.NodeIds)
+}
+
+func deleteBreakpoints(ids []int) {
+	nodeIds := []int{}
+
+	for _, id := range ids {
+		entry, err := nodeconnection.GetBreakpointEntry(id)
+		if err != nil {
+			logger.Warn("%v", err)
+			continue
+		}
+
+		if entry.Enabled {
+			removeBreakpointFromNodes(entry)
+			nodeIds = append(nodeIds, entry.NodeIds...)
+		}
+		nodeconnection.DeleteBreakpointEntry(id)
+	}
+	awaitCommandResults(nodeIds)
+}
+
+// Enabling sets the breakpoints on their nodes again, disabling removes them while keeping them in the table
+func enableBreakpoints(ids []int, enabled bool) {
+	nodeIds := []int{}
+
+	for _, id := range ids {
+		entry, err := nodeconnection.GetBreakpointEntry(id)
+		if err != nil {
+			logger.Warn("%v", err)
+			continue
+		}
+		if entry.Enabled == enabled {
+			continue
+		}
+
+		nodeconnection.SetBreakpointEnabled(id, enabled)
+		nodeIds = append(nodeIds, entry.NodeIds...)
+
+		if enabled {
+			setBreakpointOnNodes(entry)
+		} else {
+			removeBreakpointFromNodes(entry)
+		}
+	}
+	awaitCommandResults(nodeIds)
+}
+
+// Makes each node of the breakpoint pass its next count hits
+func ignoreBreakpoint(id int, count int) {
+	if _, err := nodeconnection.GetBreakpointEntry(id); err != nil {
+		logger.Warn("%v", err)
+		return
+	}
+
+	nodeconnection.SetBreakpointIgnoreCount(id, count)
+	entry, _ := nodeconnection.GetBreakpointEntry(id)
+
+	logger.Info("will ignore next %d hits of breakpoint %d", count, id)
+
+	if entry.Enabled {
+		setBreakpointOnNodes(entry)
+		awaitCommandResults(entry.NodeIds)
+	}
+}
+
+// Replaces the breakpoints held by the nodes with the ones of the table.
+// Restored nodes come back with the breakpoints of the time of the checkpoint, and reverse execution changes them while replaying
+func reapplyBreakpoints(nodeIds []int) {
+	for _, nodeId := range nodeIds {
+		nodeconnection.HandleRemotely(&command.Command{NodeId: nodeId, Code: command.RemoveBreakpoints})
+		nodeconnection.HandleRemotely(&command.Command{NodeId: nodeId, Code: command.ChangeBreakpoints, Argument: nodeconnection.NodeBreakpoints(nodeId)})
+	}
+	awaitCommandResults(nodeIds)
+}
+
+func setBreakpointOnNodes(entry nodeconnection.BreakpointEntry) {
+	for _, nodeId := range entry.NodeIds {
+		nodeconnection.HandleRemotely(&command.Command{NodeId: nodeId, Code: command.Bpoint, Argument: entry.NodeSpec(nodeId)})
+	}
+}
+
+func removeBreakpointFromNodes(entry nodeconnection.BreakpointEntry) {
+	for _, nodeId := range entry.NodeIds {
+		nodeconnection.HandleRemotely(&command.Command{NodeId: nodeId, Code: command.RemoveBreakpoint, Argument: entry.Id})
+	}
+}
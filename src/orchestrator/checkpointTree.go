@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/orchestrator/checkpointmanager"
+	nodeconnection "github.com/mihkeltiks/rev-mpi-deb/orchestrator/nodeConnection"
+)
+
+// Finds a checkpoint of the tree by its number, its label, or its image directory, as a path or as the name of the directory
+func resolveCheckpoint(reference string) (*checkpointmanager.CheckpointTree, error) {
+	if index, err := strconv.Atoi(reference); err == nil {
+		if index < 0 || index >= len(checkpoints) {
+			return nil, fmt.Errorf("no checkpoint %d, checkpoints are numbered from 0 to %d", index, len(checkpoints)-1)
+		}
+		if checkpoints[index] == "" {
+			return nil, fmt.Errorf("checkpoint %d was deleted", index)
+		}
+		return findTreeByDir(&rootCheckpointTree, checkpoints[index]), nil
+	}
+
+	if tree := checkpointmanager.FindLabel(&rootCheckpointTree, reference); tree != nil {
+		return tree, nil
+	}
+
+	for _, dir := range checkpoints {
+		if dir != "" && (filepath.Clean(reference) == dir || reference == filepath.Base(dir)) {
+			return findTreeByDir(&rootCheckpointTree, dir), nil
+		}
+	}
+
+	return nil, fmt.Errorf("no checkpoint %v", reference)
+}
+
+// Labels the checkpoint last taken or restored
+func labelCheckpoint(label string) {
+	if labelled := checkpointmanager.FindLabel(&rootCheckpointTree, label); labelled != nil {
+		logger.Warn("checkpoint %d is already labelled %v", checkpointIndex(labelled.GetCheckpointDir()), label)
+		return
+	}
+
+	currentCheckpointTree.SetLabel(label)
+	logger.Info("labelled checkpoint %d %v", checkpointIndex(currentCheckpointTree.GetCheckpointDir()), label)
+}
+
+// Deletes a checkpoint and its image directory. Checkpoints taken after it are kept, as children of the checkpoint before it
+func deleteCheckpoint(reference string) {
+	tree, err := resolveCheckpoint(reference)
+	if err != nil {
+		logger.Warn("%v", err)
+		return
+	}
+	if !tree.HasParent() {
+		logger.Warn("the first checkpoint cannot be deleted, reverse execution replays the program from it")
+		return
+	}
+
+	if tree == currentCheckpointTree {
+		// the commands executed since the checkpoint are logged from the one before it
+		currentCommandlog = append(append(checkpointmanager.CommandLog{}, *tree.GetCommandlog()...), currentCommandlog...)
+		currentCheckpointTree = tree.GetParentTree()
+	}
+
+	logger.Info("deleted checkpoint %d", removeCheckpoint(tree))
+}
+
+// Removes a checkpoint other than the current one from the tree and its image directory from the disk, returns its number
+func removeCheckpoint(tree *checkpointmanager.CheckpointTree) int {
+	index := checkpointIndex(tree.GetCheckpointDir())
+	tree.Remove()
+
+	// numbers of checkpoints stay the same
+	checkpoints[index] = ""
+
+	if err := os.RemoveAll(tree.GetCheckpointDir()); err != nil {
+		logger.Warn("cannot remove image directory of checkpoint %d: %v", index, err)
+	}
+
+	return index
+}
+
+// Prints the checkpoint tree, each checkpoint with its number, branch, label, the statement counters of the ranks
+// when it was taken and the commands executed since the checkpoint before it
+func printCheckpointTree() {
+	printCheckpointSubtree(&rootCheckpointTree, "", "")
+
+	if currentBranch == "" {
+		fmt.Printf("off any branch since restoring checkpoint %d\n", checkpointIndex(currentCheckpointTree.GetCheckpointDir()))
+	}
+	if len(currentCommandlog) > 0 {
+		fmt.Printf("commands since checkpoint %d: %v\n", checkpointIndex(currentCheckpointTree.GetCheckpointDir()), describeCommands(currentCommandlog))
+	}
+}
+
+// Prints a checkpoint after the prefix of its line, and its children below it, indented by the prefix of its other lines
+func printCheckpointSubtree(tree *checkpointmanager.CheckpointTree, linePrefix string, prefix string) {
+	description := fmt.Sprintf("%d %v", checkpointIndex(tree.GetCheckpointDir()), tree.GetBranch())
+	if tree.IsAutomatic() {
+		description += " auto"
+	}
+	if tree.GetLabel() != "" {
+		description += fmt.Sprintf(" [%v]", tree.GetLabel())
+	}
+	description += fmt.Sprintf(" %v counters %v", filepath.Base(tree.GetCheckpointDir()), describeCounters(tree.GetCounters()))
+	if tree == currentCheckpointTree {
+		description += " <- current"
+	}
+	fmt.Printf("%v%v\n", linePrefix, description)
+
+	children := tree.GetChildrenTrees()
+
+	// the commands executed since the checkpoint before, which led to this one
+	if log := *tree.GetCommandlog(); len(log) > 0 {
+		commandPrefix := prefix + "    "
+		if len(children) > 0 {
+			commandPrefix = prefix + "│   "
+		}
+		fmt.Printf("%vtaken after: %v\n", commandPrefix, describeCommands(log))
+	}
+
+	for index, child := range children {
+		if index == len(children)-1 {
+			printCheckpointSubtree(child, prefix+"└── ", prefix+"    ")
+		} else {
+			printCheckpointSubtree(child, prefix+"├── ", prefix+"│   ")
+		}
+	}
+}
+
+func describeCounters(counters []int) string {
+	described := []string{}
+	for nodeId, counter := range counters {
+		described = append(described, fmt.Sprintf("%d:%d", nodeconnection.RankOfNode(nodeId), counter))
+	}
+	return strings.Join(described, " ")
+}
+
+func describeCommands(log checkpointmanager.CommandLog) string {
+	commands := []string{}
+	for _, cmd := range log {
+		commands = append(commands, fmt.Sprintf("%v %v", commandRanks(cmd), cmd))
+	}
+	return strings.Join(commands, ", ")
+}
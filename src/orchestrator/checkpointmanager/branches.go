@@ -0,0 +1,112 @@
+package checkpointmanager
+
+// The branch the job starts on
+const MainBranch = "main"
+
+// Names of the branches of the tree, in the order they were forked
+func ListBranches(root *CheckpointTree) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+
+	root.walk(func(tree *CheckpointTree) {
+		if !seen[tree.branch] {
+			seen[tree.branch] = true
+			names = append(names, tree.branch)
+		}
+	})
+
+	return names
+}
+
+// The latest checkpoint of a branch, nil if there is no branch with the name
+func FindBranchTip(root *CheckpointTree, name string) *CheckpointTree {
+	var tip *CheckpointTree
+
+	root.walk(func(tree *CheckpointTree) {
+		if tree.branch == name && (tip == nil || tree.depth() > tip.depth()) {
+			tip = tree
+		}
+	})
+
+	return tip
+}
+
+// The checkpoints of the branch, from the one it was forked at to its tip
+func BranchCheckpoints(root *CheckpointTree, name string) []*CheckpointTree {
+	tip := FindBranchTip(root, name)
+	if tip == nil {
+		return nil
+	}
+
+	path := []*CheckpointTree{tip}
+	for tree := tip; tree.HasParent() && tree.branch == name; {
+		tree = tree.parentTree
+		path = append([]*CheckpointTree{tree}, path...)
+	}
+
+	return path
+}
+
+// Whether a checkpoint taken after this one would continue its branch, instead of forking a new one
+func (cpTree *CheckpointTree) IsBranchTip() bool {
+	for _, child := range cpTree.childrenCheckpoints {
+		if child.branch == cpTree.branch {
+			return false
+		}
+	}
+	return true
+}
+
+// The latest checkpoint both trees descend from
+func ForkPoint(a, b *CheckpointTree) *CheckpointTree {
+	ancestors := make(map[*CheckpointTree]bool)
+	for tree := a; tree != nil; tree = tree.parentTree {
+		ancestors[tree] = true
+	}
+
+	for tree := b; tree != nil; tree = tree.parentTree {
+		if ancestors[tree] {
+			return tree
+		}
+	}
+	return nil
+}
+
+// The commands executed between the ancestor and the checkpoint, in order
+func CommandsSince(ancestor, tree *CheckpointTree) CommandLog {
+	log := CommandLog{}
+
+	for ; tree != nil && tree != ancestor; tree = tree.parentTree {
+		log = append(append(CommandLog{}, tree.commandLog...), log...)
+	}
+
+	return log
+}
+
+// The checkpoint with the label, nil if no checkpoint has it
+func FindLabel(root *CheckpointTree, label string) *CheckpointTree {
+	var labelled *CheckpointTree
+
+	root.walk(func(tree *CheckpointTree) {
+		if tree.label == label {
+			labelled = tree
+		}
+	})
+
+	return labelled
+}
+
+func (cpTree *CheckpointTree) walk(visit func(tree *CheckpointTree)) {
+	visit(cpTree)
+	for _, child := range cpTree.childrenCheckpoints {
+		child.walk(visit)
+	}
+}
+
+func (cpTree *CheckpointTree) depth() int {
+	depth := 0
+	for tree := cpTree; tree.HasParent(); tree = tree.parentTree {
+		depth++
+	}
+	return depth
+}
@@ -33,6 +33,9 @@ type CheckpointTree struct {
 	checkpointDir       string
 	commandLog          CommandLog
 	counters            []int
+	branch              string // the timeline the checkpoint was taken on
+	label               string // name given by the user, empty if none
+	automatic           bool   // taken by the automatic checkpoint policy rather than by the user
 }
 
 // Data structure for maintaining a list of recorded checkpoints by node
@@ -46,7 +49,7 @@ type CommandLog []command.Command
 var checkpointLog = make(CheckpointLog)
 var checkpointLogList CheckpointLogList
 
-func MakeCheckpointTree(cplog CheckpointLog, parentcp *CheckpointTree, childrencps []*CheckpointTree, cpdir string, cmdlog CommandLog, counters []int) *CheckpointTree {
+func MakeCheckpointTree(cplog CheckpointLog, parentcp *CheckpointTree, childrencps []*CheckpointTree, cpdir string, cmdlog CommandLog, counters []int, branch string) *CheckpointTree {
 	tree := CheckpointTree{
 		checkpointLog:       cplog,
 		parentTree:          parentcp,
@@ -54,6 +57,7 @@ func MakeCheckpointTree(cplog CheckpointLog, parentcp *CheckpointTree, childrenc
 		checkpointDir:       cpdir,
 		commandLog:          cmdlog,
 		counters:            counters,
+		branch:              branch,
 	}
 
 	return &tree
@@ -87,12 +91,58 @@ func (cpTree CheckpointTree) GetCommandlog() *CommandLog {
 	return &cpTree.commandLog
 }
 
+func (cpTree CheckpointTree) GetBranch() string {
+	return cpTree.branch
+}
+
+func (cpTree CheckpointTree) GetLabel() string {
+	return cpTree.label
+}
+
+func (cpTree *CheckpointTree) SetLabel(label string) {
+	cpTree.label = label
+}
+
+func (cpTree CheckpointTree) IsAutomatic() bool {
+	return cpTree.automatic
+}
+
+func (cpTree *CheckpointTree) SetAutomatic(automatic bool) {
+	cpTree.automatic = automatic
+}
+
+// Removes the checkpoint from the tree. Its children become children of its parent,
+// with the commands executed before the checkpoint prepended to their command logs. The root cannot be removed
+func (cpTree *CheckpointTree) Remove() {
+	parent := cpTree.parentTree
+
+	for _, child := range cpTree.childrenCheckpoints {
+		child.parentTree = parent
+		child.commandLog = append(append(CommandLog{}, cpTree.commandLog...), child.commandLog...)
+	}
+
+	siblings := []*CheckpointTree{}
+	for _, sibling := range parent.childrenCheckpoints {
+		if sibling == cpTree {
+			siblings = append(siblings, cpTree.childrenCheckpoints...)
+		} else {
+			siblings = append(siblings, sibling)
+		}
+	}
+	parent.childrenCheckpoints = siblings
+
+	cpTree.parentTree = nil
+	cpTree.childrenCheckpoints = nil
+}
+
 func (cpTree CheckpointTree) Print() {
 	logger.Verbose("cplog %v", cpTree.checkpointLog)
 	logger.Verbose("parent %v", cpTree.parentTree)
 	logger.Verbose("children %v", cpTree.childrenCheckpoints)
 	logger.Verbose("cpdir %v", cpTree.checkpointDir)
 	logger.Verbose("commandlog %v", cpTree.commandLog)
+	logger.Verbose("branch %v", cpTree.branch)
+	logger.Verbose("label %v", cpTree.label)
 }
 
 func GetCheckpointLog() CheckpointLog {
@@ -136,7 +186,10 @@ func RecordCheckpoint(mpiRecord rpc.MPICallRecord) {
 		parameters:    mpiRecord.Parameters,
 	}
 
-	if nodeRanks[nodeId] == nil {
+	if mpiRecord.Rank >= 0 {
+		rank := mpiRecord.Rank
+		nodeRanks[nodeId] = &rank
+	} else if nodeRanks[nodeId] == nil {
 		nodeRanks[nodeId] = tryEvaluateIntegerParam("rank", record)
 	}
 	record.NodeRank = nodeRanks[nodeId]
@@ -173,7 +226,11 @@ func ListCheckpoints() {
 			str = fmt.Sprintf("%s,", str)
 		}
 
-		logger.Info("Node %d checkpoints:", nodeId)
+		if rank := nodeRanks[nodeId]; rank != nil {
+			logger.Info("Rank %d checkpoints:", *rank)
+		} else {
+			logger.Info("Node %d checkpoints:", nodeId)
+		}
 		logger.Info(str)
 	}
 }
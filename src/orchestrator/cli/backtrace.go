@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	nodeconnection "github.com/mihkeltiks/rev-mpi-deb/orchestrator/nodeConnection"
+)
+
+// Prints the call stacks reported by the nodes, ordered by rank
+func PrintBacktraces(nodeIds []int) {
+	sort.Slice(nodeIds, func(i, j int) bool {
+		return nodeconnection.RankOfNode(nodeIds[i]) < nodeconnection.RankOfNode(nodeIds[j])
+	})
+
+	for _, nodeId := range nodeIds {
+		rank := nodeconnection.RankOfNode(nodeId)
+		backtrace := nodeconnection.GetBacktrace(nodeId)
+
+		if backtrace == nil {
+			fmt.Printf("rank %d: no call stack reported\n", rank)
+			continue
+		}
+		if len(backtrace.Frames) == 0 {
+			fmt.Printf("rank %d: not stopped in a function with debug information\n", rank)
+			continue
+		}
+
+		fmt.Printf("rank %d:\n", rank)
+		for index, frame := range backtrace.Frames {
+			marker := " "
+			if index == backtrace.Selected {
+				marker = "*"
+			}
+			fmt.Printf(" %v#%-3d %v\n", marker, index, frame)
+		}
+	}
+}
+
+// A node of the prefix tree merging the call stacks of ranks, outermost frame at the root, as STAT does
+type stackTreeNode struct {
+	function string
+	ending   []int // ranks whose call stack ends at the node
+	children []*stackTreeNode
+}
+
+func (n *stackTreeNode) child(function string) *stackTreeNode {
+	for _, child := range n.children {
+		if child.function == function {
+			return child
+		}
+	}
+
+	child := &stackTreeNode{function: function}
+	n.children = append(n.children, child)
+	return child
+}
+
+// Prints the ranks grouped by call stack, one line per group of ranks with the same call stack.
+// Groups sharing outer frames are printed next to each other
+func PrintMergedBacktraces(nodeIds []int) {
+	root := &stackTreeNode{}
+	unknown := []int{}
+
+	for _, nodeId := range nodeIds {
+		rank := nodeconnection.RankOfNode(nodeId)
+		backtrace := nodeconnection.GetBacktrace(nodeId)
+
+		if backtrace == nil || len(backtrace.Frames) == 0 {
+			unknown = append(unknown, rank)
+			continue
+		}
+
+		treeNode := root
+		for index := len(backtrace.Frames) - 1; index >= 0; index-- {
+			treeNode = treeNode.child(backtrace.Frames[index].Function)
+		}
+		treeNode.ending = append(treeNode.ending, rank)
+	}
+
+	printStackTree(root, []string{})
+
+	if len(unknown) > 0 {
+		sort.Ints(unknown)
+		fmt.Printf("%v: no call stack\n", describeRanks(unknown))
+	}
+}
+
+func printStackTree(treeNode *stackTreeNode, path []string) {
+	if treeNode.function != "" {
+		path = append(path, treeNode.function)
+	}
+
+	if len(treeNode.ending) > 0 {
+		sort.Ints(treeNode.ending)
+		fmt.Printf("%v: %v\n", describeRanks(treeNode.ending), strings.Join(path, " <- "))
+	}
+
+	// the branches holding the lowest ranks first
+	sort.Slice(treeNode.children, func(i, j int) bool {
+		return lowestRank(treeNode.children[i]) < lowestRank(treeNode.children[j])
+	})
+
+	for _, child := range treeNode.children {
+		printStackTree(child, path)
+	}
+}
+
+func lowestRank(treeNode *stackTreeNode) int {
+	lowest := -1
+	for _, rank := range treeNode.ending {
+		if lowest == -1 || rank < lowest {
+			lowest = rank
+		}
+	}
+	for _, child := range treeNode.children {
+		if rank := lowestRank(child); rank != -1 && (lowest == -1 || rank < lowest) {
+			lowest = rank
+		}
+	}
+	return lowest
+}
+
+func describeRanks(ranks []int) string {
+	if len(ranks) == 1 {
+		return fmt.Sprintf("rank %d", ranks[0])
+	}
+	return fmt.Sprintf("ranks %v", formatRankSet(ranks))
+}
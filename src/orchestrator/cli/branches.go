@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+var branchRegexp = regexp.MustCompile(`^(branch|switch) ([a-zA-Z0-9_.-]+)$`)
+var compareRegexp = regexp.MustCompile(`^compare ([a-zA-Z0-9_.-]+) ([a-zA-Z0-9_.-]+)$`)
+
+// Parses the commands managing the branches of the checkpoint tree: branch, branches, switch and compare
+func parseBranchCommand(input string) *command.Command {
+	if input == "branches" {
+		return &command.Command{Code: command.ListBranches}
+	}
+
+	if match := branchRegexp.FindStringSubmatch(input); match != nil {
+		code := map[string]command.CommandCode{
+			"branch": command.Branch,
+			"switch": command.SwitchBranch,
+		}[match[1]]
+
+		return &command.Command{Code: code, Argument: match[2]}
+	}
+
+	if match := compareRegexp.FindStringSubmatch(input); match != nil {
+		return &command.Command{Code: command.CompareBranches, Argument: []string{match[1], match[2]}}
+	}
+
+	for _, name := range []string{"branch", "switch", "compare"} {
+		if input == name || strings.HasPrefix(input, name+" ") {
+			logger.Warn("usage: branch <name>, switch <name>, compare <name> <name>")
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	nodeconnection "github.com/mihkeltiks/rev-mpi-deb/orchestrator/nodeConnection"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+var breakpointNumbersRegexp = regexp.MustCompile(`^(delete|d|disable|enable) (\d+( \d+)*)$`)
+var ignoreRegexp = regexp.MustCompile(`^ignore (\d+) (\d+)$`)
+
+// Parses the commands managing the breakpoint table: info breakpoints, delete, disable, enable and ignore
+func parseBreakpointTableCommand(input string) *command.Command {
+	if input == "info breakpoints" || input == "info b" || input == "i b" {
+		return &command.Command{Code: command.ListBreakpoints}
+	}
+
+	if match := breakpointNumbersRegexp.FindStringSubmatch(input); match != nil {
+		ids := []int{}
+		for _, field := range strings.Fields(match[2]) {
+			id, _ := strconv.Atoi(field)
+			ids = append(ids, id)
+		}
+
+		code := map[string]command.CommandCode{
+			"delete":  command.DeleteBreakpoint,
+			"d":       command.DeleteBreakpoint,
+			"disable": command.DisableBreakpoint,
+			"enable":  command.EnableBreakpoint,
+		}[match[1]]
+
+		return &command.Command{Code: code, Argument: ids}
+	}
+
+	if match := ignoreRegexp.FindStringSubmatch(input); match != nil {
+		id, _ := strconv.Atoi(match[1])
+		count, _ := strconv.Atoi(match[2])
+
+		return &command.Command{Code: command.IgnoreBreakpoint, Argument: []int{id, count}}
+	}
+
+	for _, name := range []string{"delete", "d", "disable", "enable", "ignore"} {
+		if input == name || strings.HasPrefix(input, name+" ") {
+			logger.Warn("usage: delete|disable|enable <breakpoint numbers>, ignore <breakpoint number> <count>")
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func PrintBreakpoints() {
+	entries := nodeconnection.GetBreakpointEntries()
+
+	if len(entries) == 0 {
+		fmt.Println("no breakpoints")
+		return
+	}
+
+	fmt.Printf("  %-4v %-15v %-4v %-24v %v\n", "Num", "Type", "Enb", "Where", "Ranks")
+
+	for _, entry := range entries {
+		enabled := "y"
+		if !entry.Enabled {
+			enabled = "n"
+		}
+
+		fmt.Printf("  %-4v %-15v %-4v %-24v %v\n", entry.Id, entry.Spec.Kind(), enabled, entry.Spec.Location(), formatRankSet(ranksOfNodes(entry.NodeIds)))
+
+		if entry.Spec.Condition != "" {
+			fmt.Printf("        stop only if %v\n", entry.Spec.Condition)
+		}
+		for _, nodeId := range sortedByRank(entry.IgnoreCounts) {
+			if count := entry.IgnoreCounts[nodeId]; count > 0 {
+				fmt.Printf("        rank %d: ignore next %d hits\n", nodeconnection.RankOfNode(nodeId), count)
+			}
+		}
+		for _, nodeId := range sortedByRank(entry.Hits) {
+			fmt.Printf("        rank %d: hit %d times\n", nodeconnection.RankOfNode(nodeId), entry.Hits[nodeId])
+		}
+	}
+}
+
+func ranksOfNodes(nodeIds []int) []int {
+	ranks := make([]int, len(nodeIds))
+	for index, nodeId := range nodeIds {
+		ranks[index] = nodeconnection.RankOfNode(nodeId)
+	}
+	sort.Ints(ranks)
+	return ranks
+}
+
+// Returns the node ids keying the map, ordered by rank
+func sortedByRank(perNode map[int]int) []int {
+	nodeIds := make([]int, 0, len(perNode))
+	for nodeId := range perNode {
+		nodeIds = append(nodeIds, nodeId)
+	}
+	sort.Slice(nodeIds, func(i, j int) bool {
+		return nodeconnection.RankOfNode(nodeIds[i]) < nodeconnection.RankOfNode(nodeIds[j])
+	})
+	return nodeIds
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+var labelRegexp = regexp.MustCompile(`^label ([a-zA-Z_][a-zA-Z0-9_.-]*)$`)
+
+// checkpoints are deleted by label or image directory, or by number with delete cp, as delete <numbers> deletes breakpoints
+var deleteCheckpointRegexp = regexp.MustCompile(`^delete (cp|checkpoint) (\S+)$`)
+var deleteLabelRegexp = regexp.MustCompile(`^delete ([a-zA-Z_/.][^ ]*)$`)
+
+// Parses the commands navigating the checkpoint tree: tree, label and deleting checkpoints
+func parseCheckpointTreeCommand(input string) *command.Command {
+	if input == "tree" {
+		return &command.Command{Code: command.PrintTree}
+	}
+
+	if match := labelRegexp.FindStringSubmatch(input); match != nil {
+		return &command.Command{Code: command.Label, Argument: match[1]}
+	}
+	if input == "label" || strings.HasPrefix(input, "label ") {
+		logger.Warn("usage: label <name>, names start with a letter")
+		return nil
+	}
+
+	if match := deleteCheckpointRegexp.FindStringSubmatch(input); match != nil {
+		return &command.Command{Code: command.DeleteCheckpoint, Argument: match[2]}
+	}
+	if match := deleteLabelRegexp.FindStringSubmatch(input); match != nil {
+		return &command.Command{Code: command.DeleteCheckpoint, Argument: match[1]}
+	}
+
+	return nil
+}
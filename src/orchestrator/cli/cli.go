@@ -4,82 +4,76 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/mihkeltiks/rev-mpi-deb/logger"
 	nodeconnection "github.com/mihkeltiks/rev-mpi-deb/orchestrator/nodeConnection"
-	"github.com/mihkeltiks/rev-mpi-deb/utils"
 	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
 )
 
-func ParseArgs() (numProcesses int, targetPath string, program string) {
-	args := os.Args
-
-	sbb := strconv.Itoa(len(args))
-	logger.Error(sbb)
-	if len(args) > 4 || len(args) < 2 {
-		panicArgs()
-	}
-
-	numProcesses, err := strconv.Atoi(args[1])
-
-	if err != nil || numProcesses < 1 {
-		panicArgs()
-	}
-
-	targetPath = args[2]
-	file, err := os.Stat(targetPath)
-	utils.Must(err)
-	if file.IsDir() {
-		panicArgs()
-	}
-
-	filepath.EvalSymlinks(targetPath)
-
-	program = "criu"
-	if len(args)==4 {
-		if args[3]=="dmtcp" {
-			program="dmtcp"
-		} else if args[3]=="criu" {
-			program="criu"
-		}else{
-			panicArgs()
-		}
-	}
-
-	return numProcesses, targetPath, program
-}
-
-func panicArgs() {
-	logger.Error("usage: orchestrator <num_processes> <target_file> ")
-	os.Exit(2)
-}
-
 func PrintInstructions() {
 
 	fmt.Print("\nAvailable commands:\n\n")
 
-	fmt.Println("  <nid/all> b <lineNr> \tset breakpoint")
-	fmt.Println("  <nid/all> s \t\tsingle-step forward")
-	fmt.Println("  <nid/all> rs \t\tsingle-step backward")
-	fmt.Println("  <nid/all> c \t\tcontinue execution")
-	fmt.Println("  <nid/all> rc \t\tcontinue execution backward")
-	fmt.Println("  <nid/all> p <var>  \tprint a variable")
+	fmt.Println("  <ranks> b <lineNr> \tset breakpoint")
+	fmt.Println("  <ranks> b <file:lineNr> \tset breakpoint in a source file")
+	fmt.Println("  <ranks> b <function> \tset breakpoint at the entry of a function")
+	fmt.Println("  <ranks> b <lineNr> if <cond> \tset breakpoint, stopping only when the condition holds")
+	fmt.Println("  <ranks> tbreak <location> \tset breakpoint, removed after the first stop")
+	fmt.Println("  <ranks> watch <var> \tstop when the variable changes")
+	fmt.Println("  <ranks> rwatch <var> \tstop when the variable is read")
+	fmt.Println("  <ranks> awatch <var> \tstop when the variable is read or written")
+	fmt.Println("  <rank> rwatch-last <var> \tgo back to the statement that last changed the variable")
+	fmt.Println("  <ranks> s \t\tstep to the next line, entering calls")
+	fmt.Println("  <ranks> n \t\tstep to the next line, over calls")
+	fmt.Println("  <ranks> until [line] \trun to a later line of the function, or to the line")
+	fmt.Println("  <ranks> rs \t\tstep back to the line executed before")
+	fmt.Println("  <ranks> rn \t\tstep back to the previous line of the function, over calls")
+	fmt.Println("  <ranks> c \t\tcontinue execution")
+	fmt.Println("  <ranks> rc \t\tcontinue execution backward")
+	fmt.Println("  <ranks> finish \t\trun until the current function returns, printing its return value")
+	fmt.Println("  <rank> reverse-finish \tgo back to the call of the current function")
+	fmt.Println("  <ranks> p <expr>  \tprint a C expression: p s.field, p a[i] * 2, p *ptr, p (double) sum / n")
+	fmt.Println("  <ranks> display <expr>  \tprint an expression each time the ranks stop, display alone prints them all")
+	fmt.Println("  <ranks> undisplay [n]  \tstop displaying expression n, or all of them")
+	fmt.Println("  <ranks> set var <var> = <expr>  \tassign to a variable, or a part of it: set var a[2].v = 1.5")
+	fmt.Println("  <ranks> set $<reg> = <expr>  \tassign to a register: set $rax = 0")
+	fmt.Println("  <ranks> bt  \t\tprint the call stack, ranks with the same call stack grouped")
+	fmt.Println("  <ranks> bt full  \tprint the call stack of each rank with parameter values")
+	fmt.Println("  <ranks> frame <n>  \tselect the frame variables are printed in")
+	fmt.Println("  <ranks> up|down [n]  \tselect the frame of the caller or the callee")
+	fmt.Println("        info breakpoints  \tlist breakpoints with their hit counts")
+	fmt.Println("        delete <nums>  \tdelete breakpoints")
+	fmt.Println("        disable <nums>  \tdisable breakpoints")
+	fmt.Println("        enable <nums>  \tenable breakpoints")
+	fmt.Println("        ignore <num> <count>  \tpass the next count hits of a breakpoint on each rank")
+	fmt.Println("        group <name> <ranks>  \tname a set of ranks")
+	fmt.Println("        group  \t\tlist named sets of ranks")
 	fmt.Println("        lcp  \t\tlist recorded checkpoints")
 	fmt.Println("        r <checkpoint id>  \trollback to checkpoint")
 	fmt.Println("        cp  \tissue a checkpoint")
-	fmt.Println("        restore <var>  \tissue a restore")
+	fmt.Println("        restore <n|label|dir>  \trestore the job from a checkpoint")
+	fmt.Println("        tree  \t\tshow the checkpoint tree with counters, labels and commands")
+	fmt.Println("        label <name>  \tlabel the checkpoint last taken or restored")
+	fmt.Println("        delete <label|dir>  \tdelete a checkpoint and its images, delete cp <n> by number")
+	fmt.Println("        branch <name>  \tcheckpoint the job as a new branch forked from the checkpoint restored")
+	fmt.Println("        branches  \t\tlist branches of the checkpoint tree")
+	fmt.Println("        switch <name>  \trestore the latest checkpoint of a branch")
+	fmt.Println("        compare <name> <name>  \tcompare the counters and commands of two branches")
 	fmt.Println("        q  \t\tquit")
 	fmt.Println("     help  \t\tshow this again")
 	fmt.Println()
-	fmt.Printf("  nid (node id) in %v\n", nodeconnection.GetRegisteredIds())
+	fmt.Printf("  rank in %v\n", nodeconnection.GetRegisteredRanks())
+	fmt.Println("  ranks: a rank, all, even, odd, a group name or a list of ranks and ranges, like 0-3,7")
 	fmt.Println()
 }
 
 func AskForInput() *command.Command {
+	if activeScript != nil {
+		return activeScript.nextCommand()
+	}
+
 	PrintPrompt()
 
 	userInput := getUserInputLine()
@@ -95,11 +89,11 @@ func AskForInput() *command.Command {
 	return command
 }
 
-func getUserInputLine() string {
+var inputReader = bufio.NewReader(os.Stdin)
 
-	reader := bufio.NewReader(os.Stdin)
+func getUserInputLine() string {
 
-	text, _ := reader.ReadString('\n')
+	text, _ := inputReader.ReadString('\n')
 
 	text = strings.Replace(text, "\n", "", 1)
 
@@ -111,28 +105,21 @@ func PrintPrompt() {
 }
 
 // a command line prefixed with a pid number
-func matchPidRegexp(input string, exp string) bool {
+func matchNodeRegexp(input string, exp string) bool {
 
-	fullExpr := fmt.Sprintf(`^\d+ %v$`, exp)
-
-	return regexp.MustCompile(fullExpr).Match([]byte(input))
-}
-
-func matchAllRegexp(input string, exp string) bool {
-
-	fullExpr := fmt.Sprintf(`^all %v$`, exp)
+	fullExpr := fmt.Sprintf(`^%v$`, exp)
 
 	return regexp.MustCompile(fullExpr).Match([]byte(input))
 }
 
 func AskForRollbackCommit() bool {
-	var s string
+	if activeScript != nil {
+		fmt.Println("Committing rollback (script mode)")
+		return true
+	}
 
 	fmt.Printf("Commit rollback? (y/n): ")
-	_, err := fmt.Scan(&s)
-	if err != nil {
-		panic(err)
-	}
+	s := getUserInputLine()
 
 	s = strings.TrimSpace(s)
 	s = strings.ToLower(s)
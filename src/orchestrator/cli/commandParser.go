@@ -7,6 +7,7 @@ import (
 
 	"github.com/mihkeltiks/rev-mpi-deb/logger"
 	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/expression"
 )
 
 func parseCommandFromString(input string) (c *command.Command) {
@@ -60,10 +61,17 @@ func parseCommandFromString(input string) (c *command.Command) {
 
 	pieces := strings.Split(input, " ")
 
-	matchesRestore := regexp.MustCompile("restore .+").Match([]byte(input))
-	if matchesRestore {
-		checkpointId, _ := strconv.Atoi(pieces[1])
-		return &command.Command{Code: command.Restore, Argument: checkpointId}
+	matchesRestore := regexp.MustCompile(`^restore \S+$`).Match([]byte(input))
+	if matchesRestore { // restore the job from a checkpoint taken with cp, by number, label or image directory
+		return &command.Command{Code: command.GRestore, Argument: pieces[1]}
+	}
+
+	if c := parseBranchCommand(input); c != nil {
+		return c
+	}
+
+	if c := parseCheckpointTreeCommand(input); c != nil {
+		return c
 	}
 
 	matchesGlobalRestore := regexp.MustCompile("^r .+").Match([]byte(input))
@@ -72,74 +80,174 @@ func parseCommandFromString(input string) (c *command.Command) {
 		return &command.Command{Code: command.GlobalRollback, Argument: checkpointId}
 	}
 
-	// All node commands
-	pid, _ := strconv.Atoi(pieces[0])
-
-	matchesAllRegexp := regexp.MustCompile(`^all .+`).Match([]byte(input))
-
-	if matchesAllRegexp { // rollback operation (across n>=1 nodes)
-		switch {
-		case matchAllRegexp(input, `[b|B] \d+`): // breakpoint
-			lineNr, _ := strconv.Atoi(pieces[2])
-			return &command.Command{NodeId: -1, Code: command.Bpoint, Argument: lineNr}
-		case matchAllRegexp(input, "[c|C]"): // continue
-			return &command.Command{NodeId: -1, Code: command.Cont}
-		case matchAllRegexp(input, `rc`): // continue
-			return &command.Command{NodeId: -1, Code: command.ReverseCont}
-		case matchAllRegexp(input, `[n|N]`): // breakpoint
-			return &command.Command{NodeId: -1, Code: command.Next}
-		case matchAllRegexp(input, "[s|S]"): // single step
-			return &command.Command{NodeId: -1, Code: command.SingleStep}
-		case matchAllRegexp(input, "rs"): // single step
-			return &command.Command{NodeId: -1, Code: command.ReverseSingleStep}
-		case matchAllRegexp(input, `[p|P] [a-zA-Z_][a-zA-Z0-9_]*`): // print variable
-			identifier := strings.Split(input, " ")[2]
-			return &command.Command{NodeId: -1, Code: command.Print, Argument: identifier}
-		default:
-			return nil
-		}
+	if input == "group" || strings.HasPrefix(input, "group ") {
+		return parseGroupCommand(input)
 	}
-	// Node-specific commands (relayed to designated node for execution)
 
-	matchesPidRegexp := regexp.MustCompile(`^\d+ .+`).Match([]byte(input))
+	if c := parseBreakpointTableCommand(input); c != nil {
+		return c
+	}
+
+	// Node commands, addressed to a set of ranks (relayed to the designated nodes for execution)
 
-	if !matchesPidRegexp {
-		logger.Warn("error parsing break command - no pid specified")
+	address, nodeInput, found := strings.Cut(input, " ")
+
+	if !found {
+		logger.Warn("error parsing command - no rank specified")
 		return nil
 	}
 
+	ranks, err := parseRankSet(address)
+
+	if err != nil {
+		logger.Warn("error parsing command - %v", err)
+		return nil
+	}
+	if len(ranks) == 0 && address != "all" {
+		logger.Warn("error parsing command - rank set %v is empty", address)
+		return nil
+	}
+
+	c = parseNodeCommand(nodeInput)
+
+	if c == nil {
+		return nil
+	}
+
+	return addressCommand(c, address, ranks)
+}
+
+// Parses a node command without its address
+func parseNodeCommand(input string) *command.Command {
+	pieces := strings.Split(input, " ")
+
 	switch {
 
-	case matchPidRegexp(input, `[b|B] \d+`): // breakpoint
-		lineNr, _ := strconv.Atoi(pieces[2])
-		return &command.Command{NodeId: pid, Code: command.Bpoint, Argument: lineNr}
+	case matchNodeRegexp(input, `[b|B] .+`): // breakpoint at a line, file:line or function, optionally conditional
+		breakpoint, err := command.ParseBreakpoint(input[2:])
+		if err != nil {
+			logger.Warn("%v", err)
+			return nil
+		}
+		return &command.Command{Code: command.Bpoint, Argument: breakpoint}
+
+	case matchNodeRegexp(input, `(tbreak|tb) .+`): // breakpoint removed after the first stop
+		_, spec, _ := strings.Cut(input, " ")
+		breakpoint, err := command.ParseTemporaryBreakpoint(spec)
+		if err != nil {
+			logger.Warn("%v", err)
+			return nil
+		}
+		return &command.Command{Code: command.Bpoint, Argument: breakpoint}
+
+	case matchNodeRegexp(input, `(watch|rwatch|awatch) .+`): // hardware watchpoint on a variable
+		kind, spec, _ := strings.Cut(input, " ")
+		access := map[string]command.WatchAccess{
+			"watch":  command.WatchWrite,
+			"rwatch": command.WatchRead,
+			"awatch": command.WatchReadWrite,
+		}[kind]
+
+		watchpoint, err := command.ParseWatchpoint(spec, access)
+		if err != nil {
+			logger.Warn("%v", err)
+			return nil
+		}
+		return &command.Command{Code: command.Bpoint, Argument: watchpoint}
+
+	case matchNodeRegexp(input, `rwatch-last [a-zA-Z_][a-zA-Z0-9_]*`): // go back to the last change of a variable
+		return &command.Command{Code: command.LastChange, Argument: pieces[1]}
+
+	case matchNodeRegexp(input, `(finish|fin)`): // run until the current function returns
+		return &command.Command{Code: command.Finish}
+
+	case matchNodeRegexp(input, `reverse-finish`): // go back to the call of the current function
+		return &command.Command{Code: command.ReverseFinish}
 
-	case matchPidRegexp(input, "[c|C]"): // continue
-		return &command.Command{NodeId: pid, Code: command.Cont}
+	case matchNodeRegexp(input, "[c|C]"): // continue
+		return &command.Command{Code: command.Cont}
 
-	case matchPidRegexp(input, `rc`): // continue
-		return &command.Command{NodeId: pid, Code: command.ReverseCont}
+	case matchNodeRegexp(input, `rc`): // continue
+		return &command.Command{Code: command.ReverseCont}
 
-	case matchPidRegexp(input, "[s|S]"): // single step
-		return &command.Command{NodeId: pid, Code: command.SingleStep}
+	case matchNodeRegexp(input, "[s|S]"): // step to the next line, entering calls
+		return &command.Command{Code: command.SingleStep}
 
-	case matchPidRegexp(input, "[n|N]"): // single step
-		return &command.Command{NodeId: pid, Code: command.Next}
+	case matchNodeRegexp(input, "[n|N]"): // step to the next line, over calls
+		return &command.Command{Code: command.Next}
 
-	case matchPidRegexp(input, "rs"): // single step
-		return &command.Command{NodeId: pid, Code: command.ReverseSingleStep}
+	case matchNodeRegexp(input, `(until|u)( \d+)?`): // run to a later line of the frame
+		line := 0
+		if len(pieces) > 1 {
+			line, _ = strconv.Atoi(pieces[1])
+		}
+		return &command.Command{Code: command.Until, Argument: line}
+
+	case matchNodeRegexp(input, `(rs|reverse-step)`): // step back to the line executed before
+		return &command.Command{Code: command.ReverseSingleStep}
+
+	case matchNodeRegexp(input, `(rn|reverse-next)`): // step back to the previous line of the function
+		return &command.Command{Code: command.ReverseNext}
+
+	case matchNodeRegexp(input, `(bt|backtrace)( full)?`): // print the call stack, merged across ranks unless full
+		return &command.Command{Code: command.Backtrace, Argument: strings.HasSuffix(input, " full")}
 
-	case matchPidRegexp(input, `[p|P] [a-zA-Z_][a-zA-Z0-9_]*`): // print variable
-		identifier := strings.Split(input, " ")[2]
-		return &command.Command{NodeId: pid, Code: command.Print, Argument: identifier}
+	case matchNodeRegexp(input, `(frame|f) \d+`): // select the frame variables are printed in
+		frame, _ := strconv.Atoi(pieces[1])
+		return &command.Command{Code: command.Frame, Argument: frame}
+
+	case matchNodeRegexp(input, `(frame|f|up|down)( \d+)?`): // move the selected frame towards the callers or callees
+		count := 1
+		if len(pieces) > 1 {
+			count, _ = strconv.Atoi(pieces[1])
+		}
+		switch pieces[0] {
+		case "down":
+			count = -count
+		case "frame", "f":
+			// print the selected frame
+			count = 0
+		}
+		return &command.Command{Code: command.MoveFrame, Argument: count}
 
-	case matchPidRegexp(input, `[r|R] .+`): // restore checkpoint with supplied id
-		checkpointId := pieces[2]
-		return &command.Command{NodeId: pid, Code: command.Restore, Argument: checkpointId}
+	case matchNodeRegexp(input, `[p|P] .+`): // print the value of an expression
+		source := strings.TrimSpace(input[2:])
+		if _, err := expression.Parse(source); err != nil {
+			logger.Warn("cannot print %v: %v", source, err)
+			return nil
+		}
+		return &command.Command{Code: command.Print, Argument: source}
+
+	case matchNodeRegexp(input, `set (var|variable) .+`), matchNodeRegexp(input, `set \$.+`): // assign to a variable or register
+		assignment := strings.TrimPrefix(strings.TrimPrefix(input[len("set "):], "variable "), "var ")
+		if _, _, err := expression.ParseAssignment(assignment); err != nil {
+			logger.Warn("cannot set %v: %v", assignment, err)
+			return nil
+		}
+		return &command.Command{Code: command.SetVariable, Argument: strings.TrimSpace(assignment)}
+
+	case matchNodeRegexp(input, `display( .+)?`): // print an expression each time the ranks stop
+		source := strings.TrimSpace(strings.TrimPrefix(input, "display"))
+		if _, err := expression.Parse(source); source != "" && err != nil {
+			logger.Warn("cannot display %v: %v", source, err)
+			return nil
+		}
+		return &command.Command{Code: command.Display, Argument: source}
+
+	case matchNodeRegexp(input, `undisplay( \d+)?`): // stop displaying an expression, or all of them
+		id := 0
+		if len(pieces) > 1 {
+			id, _ = strconv.Atoi(pieces[1])
+		}
+		return &command.Command{Code: command.Undisplay, Argument: id}
+
+	case matchNodeRegexp(input, `[r|R] .+`): // restore checkpoint with supplied id
+		checkpointId := pieces[1]
+		return &command.Command{Code: command.Restore, Argument: checkpointId}
 
-	case matchPidRegexp(input, `pd [a-zA-Z_][a-zA-Z0-9_]*`): // debug print
-		varName := strings.Split(input, " ")[2]
-		return &command.Command{NodeId: pid, Code: command.PrintInternal, Argument: varName}
+	case matchNodeRegexp(input, `pd [a-zA-Z_][a-zA-Z0-9_]*`): // debug print
+		varName := pieces[1]
+		return &command.Command{Code: command.PrintInternal, Argument: varName}
 
 	default:
 		return nil
@@ -0,0 +1,360 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/utils"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// Configuration of a debugging session.
+// Values are read from an optional json session file and can be overridden with command line flags
+type Config struct {
+	NumProcesses     int      `json:"processes"`        // number of processes in the mpi job
+	Target           string   `json:"target"`           // path of the target binary
+	TargetArgs       []string `json:"targetArgs"`       // arguments passed to the target binary
+	TargetEnv        []string `json:"targetEnv"`        // additional environment variables (KEY=VALUE) of the target
+	Stdin            string   `json:"stdin"`            // file redirected to the standard input of each rank, %r is replaced with the rank
+	Backend          string   `json:"backend"`          // checkpointing backend, criu or dmtcp
+	MpirunArgs       []string `json:"mpirunArgs"`       // additional arguments for mpirun
+	CheckpointDir    string   `json:"checkpointDir"`    // directory where checkpoint images are stored
+	LogLevel         string   `json:"logLevel"`         // error, warn, info, verbose or debug
+	Headless         bool     `json:"headless"`         // do not start the graphical user interface
+	CleanupSession   bool     `json:"cleanupSession"`   // remove the checkpoints of the session on exit
+	OrchestratorPort int      `json:"orchestratorPort"` // port of the orchestrator rpc server, 0 selects a free port
+	NodePortBase     int      `json:"nodePortBase"`     // node rpc servers listen on base + rank, 0 selects free ports
+	GuiPort          int      `json:"guiPort"`          // port of the websocket server used by the gui, 0 selects a free port
+	GuiHttpPort      int      `json:"guiHttpPort"`      // port the gui is served on, 0 selects a free port
+	DmtcpPort        int      `json:"dmtcpPort"`        // port of the dmtcp coordinator, 0 selects a free port
+	Script           string   `json:"script"`           // command script to execute in batch mode
+	Breakpoints      []string `json:"breakpoints"`      // breakpoint commands applied after startup, e.g. "all b 26"
+
+	// automatic checkpoints, taken when the ranks stop after executing forward once one of the thresholds is passed, 0 disables a threshold
+	AutoCheckpointStatements int `json:"autoCheckpointStatements"` // statements executed by a rank since the last checkpoint
+	AutoCheckpointSeconds    int `json:"autoCheckpointSeconds"`    // seconds of forward execution since the last checkpoint
+	AutoCheckpointMpiEvents  int `json:"autoCheckpointMpiEvents"`  // mpi calls made by the ranks since the last checkpoint
+	CheckpointBudget         int `json:"checkpointBudget"`         // megabytes of checkpoint images, older automatic checkpoints are thinned out beyond it, 0 for no limit
+}
+
+const (
+	CRIU_BACKEND  = "criu"
+	DMTCP_BACKEND = "dmtcp"
+)
+
+func defaultConfig() *Config {
+	return &Config{
+		Backend:          CRIU_BACKEND,
+		CheckpointDir:    fmt.Sprintf("%v/temp", utils.GetExecutableDir()),
+		LogLevel:         "verbose",
+		OrchestratorPort: 3490,
+		NodePortBase:     3500,
+		GuiPort:          3496,
+		GuiHttpPort:      3495,
+		DmtcpPort:        7779,
+	}
+}
+
+// Parses the command line flags and the session file into the session configuration.
+// The legacy form <num_processes> <target_file> [criu|dmtcp] is still accepted
+func ParseArgs() *Config {
+	flagValues := defaultConfig()
+	var sessionFile, mpirunArgs string
+	var targetEnv utils.ListFlag
+	var ephemeralPorts bool
+
+	flags := flag.NewFlagSet("orchestrator", flag.ExitOnError)
+	flags.Usage = printUsage
+
+	flags.StringVar(&sessionFile, "session", "", "json session file")
+	flags.IntVar(&flagValues.NumProcesses, "np", 0, "number of processes")
+	flags.StringVar(&flagValues.Target, "target", "", "target binary")
+	flags.StringVar(&flagValues.Backend, "backend", flagValues.Backend, "checkpointing backend (criu|dmtcp)")
+	flags.Var(&targetEnv, "env", "environment variable (KEY=VALUE) of the target, can be repeated")
+	flags.StringVar(&flagValues.Stdin, "stdin", "", "file redirected to the standard input of the target, %r is replaced with the rank")
+	flags.StringVar(&mpirunArgs, "mpirun-args", "", "additional arguments for mpirun")
+	flags.StringVar(&flagValues.CheckpointDir, "checkpoint-dir", flagValues.CheckpointDir, "directory for checkpoint images")
+	flags.StringVar(&flagValues.LogLevel, "log-level", flagValues.LogLevel, "log level (error|warn|info|verbose|debug)")
+	flags.BoolVar(&flagValues.Headless, "headless", false, "do not start the gui")
+	flags.BoolVar(&flagValues.CleanupSession, "cleanup", false, "remove the checkpoints of the session on exit")
+	flags.IntVar(&flagValues.OrchestratorPort, "port", flagValues.OrchestratorPort, "orchestrator rpc port")
+	flags.IntVar(&flagValues.NodePortBase, "node-port", flagValues.NodePortBase, "node rpc ports start from this port")
+	flags.IntVar(&flagValues.GuiPort, "gui-port", flagValues.GuiPort, "gui websocket port")
+	flags.IntVar(&flagValues.GuiHttpPort, "gui-http-port", flagValues.GuiHttpPort, "port the gui is served on")
+	flags.IntVar(&flagValues.DmtcpPort, "dmtcp-port", flagValues.DmtcpPort, "dmtcp coordinator port")
+	flags.BoolVar(&ephemeralPorts, "ephemeral-ports", false, "select free ports for all servers")
+	flags.StringVar(&flagValues.Script, "script", "", "command script to execute in batch mode")
+	flags.IntVar(&flagValues.AutoCheckpointStatements, "auto-cp-statements", 0, "checkpoint automatically after this many statements on a rank")
+	flags.IntVar(&flagValues.AutoCheckpointSeconds, "auto-cp-seconds", 0, "checkpoint automatically after this many seconds of execution")
+	flags.IntVar(&flagValues.AutoCheckpointMpiEvents, "auto-cp-mpi", 0, "checkpoint automatically after this many mpi calls")
+	flags.IntVar(&flagValues.CheckpointBudget, "cp-budget", 0, "megabytes of checkpoint images kept, automatic checkpoints are thinned out beyond it")
+
+	flags.Parse(os.Args[1:])
+
+	config := defaultConfig()
+
+	if sessionFile != "" {
+		err := loadSessionFile(sessionFile, config)
+		if err != nil {
+			logger.Error("cannot read session file: %v", err)
+			os.Exit(2)
+		}
+	}
+
+	// flags take precedence over the session file
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "np":
+			config.NumProcesses = flagValues.NumProcesses
+		case "target":
+			config.Target = flagValues.Target
+		case "backend":
+			config.Backend = flagValues.Backend
+		case "env":
+			config.TargetEnv = targetEnv
+		case "stdin":
+			config.Stdin = flagValues.Stdin
+		case "mpirun-args":
+			config.MpirunArgs = strings.Fields(mpirunArgs)
+		case "checkpoint-dir":
+			config.CheckpointDir = flagValues.CheckpointDir
+		case "log-level":
+			config.LogLevel = flagValues.LogLevel
+		case "headless":
+			config.Headless = flagValues.Headless
+		case "cleanup":
+			config.CleanupSession = flagValues.CleanupSession
+		case "port":
+			config.OrchestratorPort = flagValues.OrchestratorPort
+		case "node-port":
+			config.NodePortBase = flagValues.NodePortBase
+		case "gui-port":
+			config.GuiPort = flagValues.GuiPort
+		case "gui-http-port":
+			config.GuiHttpPort = flagValues.GuiHttpPort
+		case "dmtcp-port":
+			config.DmtcpPort = flagValues.DmtcpPort
+		case "script":
+			config.Script = flagValues.Script
+		case "auto-cp-statements":
+			config.AutoCheckpointStatements = flagValues.AutoCheckpointStatements
+		case "auto-cp-seconds":
+			config.AutoCheckpointSeconds = flagValues.AutoCheckpointSeconds
+		case "auto-cp-mpi":
+			config.AutoCheckpointMpiEvents = flagValues.AutoCheckpointMpiEvents
+		case "cp-budget":
+			config.CheckpointBudget = flagValues.CheckpointBudget
+		}
+	})
+
+	if ephemeralPorts {
+		config.OrchestratorPort = 0
+		config.NodePortBase = 0
+		config.GuiPort = 0
+		config.GuiHttpPort = 0
+		config.DmtcpPort = 0
+	}
+
+	args := flags.Args()
+
+	if config.Target == "" {
+		args = parseLegacyArgs(args, config)
+	}
+	if len(args) > 0 {
+		config.TargetArgs = args
+	}
+
+	// rank sets of the session breakpoints, like even or 1-3, are resolved against the ranks of the session
+	rankCount = config.NumProcesses
+
+	if err := config.validate(); err != nil {
+		logger.Error("%v", err)
+		printUsage()
+		os.Exit(2)
+	}
+
+	return config
+}
+
+// <num_processes> <target_file> [criu|dmtcp] [-- target args]
+func parseLegacyArgs(args []string, config *Config) (remainingArgs []string) {
+	if len(args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	numProcesses, err := strconv.Atoi(args[0])
+	if err != nil {
+		printUsage()
+		os.Exit(2)
+	}
+
+	config.NumProcesses = numProcesses
+	config.Target = args[1]
+	args = args[2:]
+
+	if len(args) > 0 && (args[0] == CRIU_BACKEND || args[0] == DMTCP_BACKEND) {
+		config.Backend = args[0]
+		args = args[1:]
+	}
+
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
+	return args
+}
+
+func loadSessionFile(path string, config *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	// relative paths in the session file are relative to the file itself
+	baseDir := filepath.Dir(path)
+	for _, filePath := range []*string{&config.Target, &config.Script, &config.Stdin} {
+		if *filePath != "" && !filepath.IsAbs(*filePath) {
+			*filePath = filepath.Join(baseDir, *filePath)
+		}
+	}
+
+	return nil
+}
+
+func (config *Config) validate() error {
+	if config.NumProcesses < 1 {
+		return fmt.Errorf("invalid number of processes: %d", config.NumProcesses)
+	}
+
+	file, err := os.Stat(config.Target)
+	if err != nil {
+		return fmt.Errorf("invalid target: %v", err)
+	}
+	if file.IsDir() {
+		return fmt.Errorf("invalid target: %v is a directory", config.Target)
+	}
+
+	if config.Backend != CRIU_BACKEND && config.Backend != DMTCP_BACKEND {
+		return fmt.Errorf("unknown checkpointing backend: %v", config.Backend)
+	}
+
+	if _, err := logger.ParseLevel(config.LogLevel); err != nil {
+		return err
+	}
+
+	for _, variable := range config.TargetEnv {
+		if !strings.Contains(variable, "=") {
+			return fmt.Errorf("invalid environment variable %q, expected KEY=VALUE", variable)
+		}
+	}
+
+	if config.Stdin != "" {
+		stdin, err := filepath.Abs(config.Stdin)
+		if err != nil {
+			return err
+		}
+		config.Stdin = stdin
+
+		if !strings.Contains(stdin, "%r") {
+			if _, err := os.Stat(stdin); err != nil {
+				return fmt.Errorf("invalid stdin file: %v", err)
+			}
+		}
+	}
+
+	if config.AutoCheckpointStatements < 0 || config.AutoCheckpointSeconds < 0 || config.AutoCheckpointMpiEvents < 0 || config.CheckpointBudget < 0 {
+		return fmt.Errorf("automatic checkpoint thresholds and the checkpoint budget cannot be negative")
+	}
+
+	for _, breakpoint := range config.Breakpoints {
+		cmd := parseCommandFromString(breakpoint)
+		// rank sets outside the session or resolving to no ranks are rejected by the parser
+		if cmd == nil || cmd.Code != command.Bpoint {
+			return fmt.Errorf("invalid breakpoint in session: %q", breakpoint)
+		}
+	}
+
+	return nil
+}
+
+// Returns the breakpoint commands listed in the session
+func (config *Config) InitialBreakpoints() []*command.Command {
+	commands := make([]*command.Command, 0, len(config.Breakpoints))
+
+	for _, breakpoint := range config.Breakpoints {
+		commands = append(commands, parseCommandFromString(breakpoint))
+	}
+
+	return commands
+}
+
+func (config *Config) MaxLogLevel() logger.LoggingLevel {
+	level, _ := logger.ParseLevel(config.LogLevel)
+	return level
+}
+
+func printUsage() {
+	fmt.Println("usage: orchestrator [flags] -np <num_processes> -target <target_file> [-- target args]")
+	fmt.Println("       orchestrator [flags] <num_processes> <target_file> [criu|dmtcp] [-- target args]")
+	fmt.Println()
+	fmt.Println("flags:")
+	fmt.Println("  -session <file>        json session file, flags override its values")
+	fmt.Println("  -np <n>                number of processes")
+	fmt.Println("  -target <file>         target binary")
+	fmt.Println("  -backend <criu|dmtcp>  checkpointing backend (default criu)")
+	fmt.Println("  -env <KEY=VALUE>       environment variable of the target, can be repeated")
+	fmt.Println("  -stdin <file>          file redirected to the stdin of each rank, %r is replaced with the rank")
+	fmt.Println("  -mpirun-args <args>    additional arguments for mpirun")
+	fmt.Println("  -checkpoint-dir <dir>  directory for checkpoint images")
+	fmt.Println("  -log-level <level>     error, warn, info, verbose or debug")
+	fmt.Println("  -headless              do not start the gui, its websocket server is still started")
+	fmt.Println("  -cleanup               remove the checkpoints of the session on exit")
+	fmt.Println("  -port <port>           orchestrator rpc port (default 3490)")
+	fmt.Println("  -node-port <port>      node rpc servers listen on this port + rank (default 3500)")
+	fmt.Println("  -gui-port <port>       gui websocket port (default 3496)")
+	fmt.Println("  -gui-http-port <port>  port the gui is served on (default 3495)")
+	fmt.Println("  -dmtcp-port <port>     dmtcp coordinator port (default 7779)")
+	fmt.Println("  -ephemeral-ports       select free ports for all servers, a port of 0 does the same for a single server")
+	fmt.Println("  -script <file>         execute a command script in batch mode")
+	fmt.Println("  -auto-cp-statements <n>  checkpoint automatically once a rank has executed n statements since the last checkpoint")
+	fmt.Println("  -auto-cp-seconds <t>   checkpoint automatically after t seconds of forward execution since the last checkpoint")
+	fmt.Println("  -auto-cp-mpi <k>       checkpoint automatically after k mpi calls since the last checkpoint")
+	fmt.Println("  -cp-budget <mb>        megabytes of checkpoint images, older automatic checkpoints are thinned out beyond it")
+}
+
+// Returns the node debugger command line for the target: the launch options, the target and the orchestrator address
+// followed by the arguments of the target
+func (config *Config) NodeDebuggerArgs(nodeDebuggerPath string, orchestratorAddress string, tempDir string) []string {
+	args := []string{
+		nodeDebuggerPath,
+		"-port-base", fmt.Sprint(config.NodePortBase),
+		"-temp-dir", tempDir,
+	}
+
+	for _, variable := range config.TargetEnv {
+		args = append(args, "-env", variable)
+	}
+	if config.Stdin != "" {
+		args = append(args, "-stdin", config.Stdin)
+	}
+
+	args = append(args, config.Target, orchestratorAddress)
+	args = append(args, config.TargetArgs...)
+
+	return args
+}
@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// number of ranks in the session, used for resolving rank sets like even and odd
+var rankCount int
+
+// named rank sets defined with the group command, keys - group names
+var rankGroups = make(map[string][]int)
+
+// Argument of a group command defining a group
+type RankGroup struct {
+	Name  string
+	Ranks []int
+}
+
+var rankListRegexp = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+var groupNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Resolves the address of a node command into ranks.
+// The address is all, even, odd, a group name, or a list of ranks and ranges, like 0-3,7
+func parseRankSet(address string) ([]int, error) {
+	switch address {
+	case "all":
+		return rankRange(0, rankCount-1), nil
+	case "even", "odd":
+		ids := []int{}
+		for id := 0; id < rankCount; id++ {
+			if (id%2 == 0) == (address == "even") {
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+
+	if ids, ok := rankGroups[address]; ok {
+		return ids, nil
+	}
+
+	if !rankListRegexp.MatchString(address) {
+		return nil, fmt.Errorf("unknown rank set %q", address)
+	}
+
+	seen := make(map[int]bool)
+	ids := []int{}
+
+	for _, item := range strings.Split(address, ",") {
+		start, end := item, item
+		if bounds := strings.SplitN(item, "-", 2); len(bounds) == 2 {
+			start, end = bounds[0], bounds[1]
+		}
+
+		first, _ := strconv.Atoi(start)
+		last, _ := strconv.Atoi(end)
+
+		if first > last {
+			return nil, fmt.Errorf("invalid rank range %q", item)
+		}
+		if rankCount > 0 && last >= rankCount {
+			return nil, fmt.Errorf("rank %d out of range, ranks in 0-%d", last, rankCount-1)
+		}
+
+		for _, id := range rankRange(first, last) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func rankRange(first int, last int) []int {
+	ids := []int{}
+	for id := first; id <= last; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Addresses the command to the given ranks, which are converted to node ids before the command is executed.
+// Commands for a single rank or for all ranks keep using NodeId, so they are handled as before
+func addressCommand(cmd *command.Command, address string, ids []int) *command.Command {
+	switch {
+	case address == "all" || (rankCount > 0 && len(ids) == rankCount):
+		cmd.NodeId = command.AllNodes
+	case len(ids) == 1:
+		cmd.NodeId = ids[0]
+	default:
+		cmd.NodeId = command.NodeSet
+		cmd.NodeIds = ids
+	}
+	return cmd
+}
+
+// Parses the group command: "group" lists the defined groups, "group <name> <rank set>" defines one
+func parseGroupCommand(input string) *command.Command {
+	pieces := strings.Fields(input)
+
+	if len(pieces) == 1 {
+		return &command.Command{Code: command.Group}
+	}
+
+	if len(pieces) != 3 {
+		return nil
+	}
+
+	name := pieces[1]
+	if !groupNameRegexp.MatchString(name) || name == "all" || name == "even" || name == "odd" {
+		fmt.Printf("invalid group name %q\n", name)
+		return nil
+	}
+
+	ids, err := parseRankSet(pieces[2])
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	if len(ids) == 0 {
+		fmt.Printf("group %v would be empty\n", name)
+		return nil
+	}
+
+	return &command.Command{Code: command.Group, Argument: RankGroup{Name: name, Ranks: ids}}
+}
+
+// Defines the group, replacing an earlier one of the same name
+func DefineRankGroup(group RankGroup) {
+	rankGroups[group.Name] = group.Ranks
+	fmt.Printf("  %v: %v\n", group.Name, formatRankSet(group.Ranks))
+}
+
+func PrintRankGroups() {
+	if len(rankGroups) == 0 {
+		fmt.Println("no groups defined")
+		return
+	}
+
+	names := make([]string, 0, len(rankGroups))
+	for name := range rankGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("  %v: %v\n", name, formatRankSet(rankGroups[name]))
+	}
+}
+
+// Formats sorted ranks compactly, like 0-3,7
+func formatRankSet(ids []int) string {
+	parts := []string{}
+
+	for i := 0; i < len(ids); {
+		j := i
+		for j+1 < len(ids) && ids[j+1] == ids[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(ids[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", ids[i], ids[j]))
+		}
+		i = j + 1
+	}
+
+	return strings.Join(parts, ",")
+}
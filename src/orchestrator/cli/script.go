@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// A debugging session read from a file, executed command by command in batch mode
+type Script struct {
+	path  string
+	lines []scriptLine
+	next  int
+}
+
+type scriptLine struct {
+	number int    // line number in the script file
+	input  string // the command as it would be typed in the interactive cli
+}
+
+var activeScript *Script
+
+// Reads the script file and validates every command in it,
+// so that a broken script fails before the mpi job is started.
+// Groups the script defines are known to the lines after them while validating, and are defined for the session when executed.
+// Empty lines and lines starting with # are ignored
+func LoadScript(path string) (*Script, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sessionGroups := rankGroups
+	rankGroups = make(map[string][]int)
+	for name, ids := range sessionGroups {
+		rankGroups[name] = ids
+	}
+	defer func() { rankGroups = sessionGroups }()
+
+	script := &Script{path: path}
+
+	scanner := bufio.NewScanner(file)
+	lineNr := 0
+
+	for scanner.Scan() {
+		lineNr++
+		input := strings.TrimSpace(scanner.Text())
+
+		if input == "" || strings.HasPrefix(input, "#") {
+			continue
+		}
+
+		cmd := parseCommandFromString(input)
+		if cmd == nil {
+			return nil, fmt.Errorf("%s:%d: invalid command %q", path, lineNr, input)
+		}
+		if group, ok := cmd.Argument.(RankGroup); ok && cmd.Code == command.Group {
+			rankGroups[group.Name] = group.Ranks
+		}
+
+		script.lines = append(script.lines, scriptLine{lineNr, input})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return script, nil
+}
+
+// Makes the cli take its input from the script instead of the standard input
+func UseScript(script *Script) {
+	activeScript = script
+}
+
+func IsScriptMode() bool {
+	return activeScript != nil
+}
+
+// Returns the next command of the script, echoing it the way it would appear in an interactive session.
+// Once the script is exhausted, a quit command is returned
+func (s *Script) nextCommand() *command.Command {
+	if s.next >= len(s.lines) {
+		fmt.Println("end of script")
+		return &command.Command{Code: command.Quit}
+	}
+
+	line := s.lines[s.next]
+	s.next++
+
+	PrintPrompt()
+	fmt.Printf("%s\t(%s:%d)\n", line.input, s.path, line.number)
+
+	return parseCommandFromString(line.input)
+}
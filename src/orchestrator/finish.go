@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	nodeconnection "github.com/mihkeltiks/rev-mpi-deb/orchestrator/nodeConnection"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// Goes back to the statement calling the function a rank is in.
+// The program is replayed from the latest checkpoint before it with the rank sampling its frame at every statement counter
+// up to its current one, then replayed again to the counter of the calling statement
+func goToCallSite(cmd *command.Command) {
+	rank := nodeconnection.RankOfNode(cmd.NodeId)
+	counters := retrieveCounters()
+
+	// the replays pass breakpoints the user has already seen hit
+	nodeconnection.SetBreakpointHitRecording(false)
+	defer nodeconnection.SetBreakpointHitRecording(true)
+
+	callSite := replaySampling(counters, []*command.Command{{
+		NodeId:   cmd.NodeId,
+		Code:     command.CallSite,
+		Argument: counters[cmd.NodeId],
+	}})[cmd.NodeId]
+
+	if callSite <= 0 {
+		// the replay ran every rank back to where it was
+		logger.Info("rank %d is in the outermost frame, there is no call site to go back to", rank)
+	} else {
+		counters[cmd.NodeId] = callSite
+
+		replayToCounters(counters)
+
+		logger.Info("rank %d: back at the call site, at counter %d", rank, callSite)
+	}
+
+	endReplay(counters)
+}
@@ -2,7 +2,9 @@ package gui
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"syscall"
 
 	"github.com/mihkeltiks/rev-mpi-deb/logger"
 	"github.com/mihkeltiks/rev-mpi-deb/utils"
@@ -10,7 +12,9 @@ import (
 
 var guiProcess *exec.Cmd
 
-func Start() {
+// Starts the gui on the http port, connecting to the websocket server at the websocket port.
+// An http port of 0 lets the gui select a free port
+func Start(websocketPort int, httpPort int) {
 	npmPath, err := exec.LookPath("npm")
 	if err != nil {
 		logger.Error("Cannot find npm: %v:", err)
@@ -23,6 +27,9 @@ func Start() {
 		Path: npmPath,
 		Args: []string{"npm", "run", "start:open"},
 		Dir:  guiDir,
+		Env:  append(os.Environ(), fmt.Sprintf("WS_PORT=%d", websocketPort), fmt.Sprintf("GUI_PORT=%v", guiPortArg(httpPort))),
+		// own process group, so that stopping the gui leaves the guis of other sessions running
+		SysProcAttr: &syscall.SysProcAttr{Setpgid: true},
 	}
 
 	// cmd.Stdout = os.Stdout
@@ -40,12 +47,19 @@ func Start() {
 	guiProcess = &cmd
 }
 
+func guiPortArg(httpPort int) string {
+	if httpPort == 0 {
+		return "auto"
+	}
+	return fmt.Sprint(httpPort)
+}
+
 func Stop() {
 	if guiProcess != nil {
 		logger.Info("Stopping gui")
 
-		// unfortunately the gui process is very hard to kill, using this as a workaround
-		exec.Command("pkill", "-f", "webpack").Run()
+		// npm does not forward signals to webpack, so the whole process group is killed
+		syscall.Kill(-guiProcess.Process.Pid, syscall.SIGTERM)
 	}
 }
 
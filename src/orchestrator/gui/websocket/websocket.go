@@ -2,6 +2,8 @@ package websocket
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 
 	"github.com/gorilla/websocket"
@@ -11,8 +13,6 @@ import (
 
 var connection *websocket.Conn
 
-const ADDRESS = "localhost:3496"
-
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
@@ -78,11 +78,19 @@ func handler() func(http.ResponseWriter, *http.Request) {
 
 }
 
-func InitServer() {
-	http.HandleFunc("/", handler())
+// Starts the websocket server for the gui and returns the port it listens on.
+// Port 0 selects a free port
+func InitServer(port int) int {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler())
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port))
+	utils.Must(err)
+
+	logger.Verbose("starting websocket server for gui on %v", listener.Addr())
+	go http.Serve(listener, mux)
 
-	logger.Verbose("starting websocket server for gui")
-	go http.ListenAndServe(ADDRESS, nil)
+	return listener.Addr().(*net.TCPAddr).Port
 }
 
 func WaitForClientConnection() {
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	"github.com/mihkeltiks/rev-mpi-deb/orchestrator/checkpointmanager"
+	"github.com/mihkeltiks/rev-mpi-deb/orchestrator/gui/websocket"
+	nodeconnection "github.com/mihkeltiks/rev-mpi-deb/orchestrator/nodeConnection"
+	"github.com/mihkeltiks/rev-mpi-deb/rpc"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// Goes back to the statement that last changed a variable on a rank.
+// The variable is located at the current stop of the rank, then the program is replayed from the latest checkpoint before it
+// with the rank sampling the variable at every statement counter up to its current one, and replayed again to the counter of the changing statement
+func goToLastChange(cmd *command.Command) {
+	variable := cmd.Argument.(string)
+	rank := nodeconnection.RankOfNode(cmd.NodeId)
+
+	location := locateVariable(cmd.NodeId, variable)
+	if location == nil {
+		// the rank reported why
+		return
+	}
+	counters := retrieveCounters()
+
+	// the replays pass breakpoints the user has already seen hit
+	nodeconnection.SetBreakpointHitRecording(false)
+	defer nodeconnection.SetBreakpointHitRecording(true)
+
+	lastChange := replaySampling(counters, []*command.Command{{
+		NodeId: cmd.NodeId,
+		Code:   command.LastChange,
+		Argument: command.VariableSampling{
+			Variable: variable,
+			Counter:  counters[cmd.NodeId],
+			Address:  location.Address,
+			Frame:    location.Frame,
+			Function: location.Function,
+		},
+	}})[cmd.NodeId]
+
+	if lastChange <= 0 {
+		// the replay ran every rank back to where it was
+		logger.Info("%v did not change on rank %d", variable, rank)
+	} else {
+		// stop before the changing statement, at least at the first counter
+		counters[cmd.NodeId] = max(lastChange-1, 1)
+
+		replayToCounters(counters)
+
+		logger.Info("rank %d: %v was last changed by the statement at counter %d", rank, variable, counters[cmd.NodeId])
+	}
+
+	endReplay(counters)
+}
+
+// Has the node locate the variable at its current stop, returns nil if it cannot find it
+func locateVariable(nodeId int, variable string) *rpc.VariableLocation {
+	nodeconnection.TakeVariableLocation(nodeId)
+	nodeconnection.HandleRemotely(&command.Command{NodeId: nodeId, Code: command.Locate, Argument: variable})
+	nodeconnection.WaitForCommandResults([]int{nodeId}, 0)
+
+	return nodeconnection.TakeVariableLocation(nodeId)
+}
+
+// Replays the program from the latest checkpoint before the counters, the nodes of the sampling commands running them
+// while the other nodes run to their counters, and returns the counters reported by the sampling nodes, by node id.
+// Samplings find nothing before the checkpoint, so nodes reporting nothing sample again from the checkpoints before it
+func replaySampling(counters []int, samplings []*command.Command) []int {
+	sampled := make([]int, len(counters))
+	tree := findTreeCandidateCounter(counters, currentCheckpointTree)
+
+	for {
+		reported := replaySamplingFrom(tree, counters, samplings)
+
+		unfound := []*command.Command{}
+		for _, sampling := range samplings {
+			if reported[sampling.NodeId] > 0 {
+				sampled[sampling.NodeId] = reported[sampling.NodeId]
+			} else {
+				unfound = append(unfound, sampling)
+			}
+		}
+
+		if len(unfound) == 0 || !tree.HasParent() {
+			return sampled
+		}
+
+		samplings = unfound
+		tree = findTreeCandidateCounter(counters, tree.GetParentTree())
+	}
+}
+
+func replaySamplingFrom(tree *checkpointmanager.CheckpointTree, counters []int, samplings []*command.Command) []int {
+	restoreForReplay(tree)
+	nodeconnection.ResetAllNodeCounters()
+
+	for index, counter := range counters {
+		sampled := false
+		for _, sampling := range samplings {
+			if sampling.NodeId == index {
+				nodeconnection.HandleRemotely(sampling)
+				sampled = true
+			}
+		}
+		if !sampled {
+			runToCounter(tree, index, counter)
+		}
+	}
+	nodeconnection.WaitForCommandResults(nodeconnection.GetRegisteredIds(), 0)
+
+	return nodeconnection.GetAllNodeCounters()
+}
+
+// Replays the program from the latest checkpoint before the counters, running the nodes to their counters
+func replayToCounters(counters []int) {
+	tree := findTreeCandidateCounter(counters, currentCheckpointTree)
+	restoreForReplay(tree)
+
+	for index, counter := range counters {
+		runToCounter(tree, index, counter)
+	}
+	nodeconnection.WaitForCommandResults(nodeconnection.GetRegisteredIds(), 0)
+}
+
+// Runs a node restored from the checkpoint to the counter.
+// A node stops when its counter is incremented to the target, so nodes already there are left where they are
+func runToCounter(tree *checkpointmanager.CheckpointTree, nodeId int, counter int) {
+	if nodeId < len(tree.GetCounters()) && tree.GetCounters()[nodeId] == counter {
+		return
+	}
+
+	nodeconnection.HandleRemotely(&command.Command{NodeId: nodeId, Code: command.Insert, Argument: counter})
+	nodeconnection.HandleRemotely(&command.Command{NodeId: nodeId, Code: command.Cont})
+}
+
+// Lifts the counter targets of the nodes and sets the breakpoints back after a replay
+func endReplay(counters []int) {
+	for index := range counters {
+		nodeconnection.HandleRemotely(&command.Command{NodeId: index, Code: command.Insert, Argument: 2000000})
+	}
+	reapplyBreakpoints(nodeconnection.GetRegisteredIds())
+
+	nodeconnection.ResetAllNodeCounters()
+}
+
+// Returns the current statement counters of the nodes, by node id
+func retrieveCounters() []int {
+	nodeconnection.ResetAllNodeCounters()
+	nodeconnection.HandleRemotely(&command.Command{NodeId: command.AllNodes, Code: command.Retrieve, Argument: "counter"})
+
+	for {
+		counters := nodeconnection.GetAllNodeCounters()
+
+		reported := true
+		for _, counter := range counters {
+			reported = reported && counter != -1
+		}
+		if reported {
+			return counters
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Restores the checkpoint a replay starts from and removes the breakpoints from the nodes, so that they run to their counter targets.
+// The checkpoint stays the current one of the tree, replays do not move the job to another branch
+func restoreForReplay(tree *checkpointmanager.CheckpointTree) {
+	logger.Verbose("replaying from checkpoint %d", checkpointIndex(tree.GetCheckpointDir()))
+
+	index := checkpointIndex(tree.GetCheckpointDir())
+	restore(tree.GetCheckpointDir(), pid, numProcesses)
+	websocket.HandleCriuRestore(index)
+	checkpointmanager.SetCheckpointLog(index)
+	// the replay goes back before variables changed at the current stop
+	variablesChanged = false
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	connectBackToNodes(numProcesses, true, &wg)
+	wg.Wait()
+
+	nodeconnection.HandleRemotely(&command.Command{NodeId: command.AllNodes, Code: command.RemoveBreakpoints})
+	nodeconnection.WaitForCommandResults(nodeconnection.GetRegisteredIds(), 0)
+}
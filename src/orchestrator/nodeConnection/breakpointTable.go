@@ -0,0 +1,217 @@
+package nodeconnection
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mihkeltiks/rev-mpi-deb/rpc"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// A numbered breakpoint set by the user on a set of nodes
+type BreakpointEntry struct {
+	Id           int
+	Spec         command.Breakpoint
+	Enabled      bool
+	NodeIds      []int          // nodes the breakpoint is set on, temporary breakpoints leave a node after stopping it
+	Hits         map[int]int    // keys - node ids
+	IgnoreCounts map[int]int    // hits still to be ignored, keys - node ids
+	WatchFrames  map[int]uint64 // frames of the variable of a watchpoint on a local, keys - node ids
+}
+
+// The breakpoint as set on the given node
+func (b *BreakpointEntry) NodeSpec(nodeId int) command.Breakpoint {
+	spec := b.Spec
+	spec.Id = b.Id
+	spec.IgnoreCount = b.IgnoreCounts[nodeId]
+	spec.WatchFrame = b.WatchFrames[nodeId]
+	return spec
+}
+
+// Copies the entry, so it can be read outside of the table lock
+func (b *BreakpointEntry) copy() BreakpointEntry {
+	entry := *b
+	entry.NodeIds = append([]int{}, b.NodeIds...)
+	entry.Hits = make(map[int]int)
+	entry.IgnoreCounts = make(map[int]int)
+	entry.WatchFrames = make(map[int]uint64)
+
+	for nodeId, hits := range b.Hits {
+		entry.Hits[nodeId] = hits
+	}
+	for nodeId, count := range b.IgnoreCounts {
+		entry.IgnoreCounts[nodeId] = count
+	}
+	for nodeId, frame := range b.WatchFrames {
+		entry.WatchFrames[nodeId] = frame
+	}
+	return entry
+}
+
+// The table of breakpoints is kept by the orchestrator, nodes only know the breakpoints set on them
+var breakpointTable = struct {
+	mu            sync.Mutex
+	entries       map[int]*BreakpointEntry
+	lastId        int
+	recordingHits bool
+}{
+	entries:       make(map[int]*BreakpointEntry),
+	recordingHits: true,
+}
+
+func AddBreakpointEntry(spec command.Breakpoint, nodeIds []int) BreakpointEntry {
+	breakpointTable.mu.Lock()
+	defer breakpointTable.mu.Unlock()
+
+	breakpointTable.lastId++
+
+	entry := &BreakpointEntry{
+		Id:           breakpointTable.lastId,
+		Spec:         spec,
+		Enabled:      true,
+		NodeIds:      nodeIds,
+		Hits:         make(map[int]int),
+		IgnoreCounts: make(map[int]int),
+		WatchFrames:  make(map[int]uint64),
+	}
+	breakpointTable.entries[entry.Id] = entry
+
+	return entry.copy()
+}
+
+func GetBreakpointEntry(id int) (BreakpointEntry, error) {
+	breakpointTable.mu.Lock()
+	defer breakpointTable.mu.Unlock()
+
+	entry := breakpointTable.entries[id]
+	if entry == nil {
+		return BreakpointEntry{}, fmt.Errorf("no breakpoint number %d", id)
+	}
+	return entry.copy(), nil
+}
+
+// Returns the breakpoints of the table, ordered by number
+func GetBreakpointEntries() []BreakpointEntry {
+	breakpointTable.mu.Lock()
+	defer breakpointTable.mu.Unlock()
+
+	entries := make([]BreakpointEntry, 0, len(breakpointTable.entries))
+	for _, entry := range breakpointTable.entries {
+		entries = append(entries, entry.copy())
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Id < entries[j].Id })
+
+	return entries
+}
+
+// Returns the enabled breakpoints of the table set on the node, as sent to it
+func NodeBreakpoints(nodeId int) []command.Breakpoint {
+	breakpointTable.mu.Lock()
+	defer breakpointTable.mu.Unlock()
+
+	breakpoints := []command.Breakpoint{}
+
+	for id := 1; id <= breakpointTable.lastId; id++ {
+		entry := breakpointTable.entries[id]
+		if entry == nil || !entry.Enabled {
+			continue
+		}
+		for _, entryNodeId := range entry.NodeIds {
+			if entryNodeId == nodeId {
+				breakpoints = append(breakpoints, entry.NodeSpec(nodeId))
+			}
+		}
+	}
+
+	return breakpoints
+}
+
+func DeleteBreakpointEntry(id int) {
+	breakpointTable.mu.Lock()
+	defer breakpointTable.mu.Unlock()
+
+	delete(breakpointTable.entries, id)
+}
+
+func SetBreakpointEnabled(id int, enabled bool) {
+	breakpointTable.mu.Lock()
+	defer breakpointTable.mu.Unlock()
+
+	if entry := breakpointTable.entries[id]; entry != nil {
+		entry.Enabled = enabled
+	}
+}
+
+// Sets the number of hits to ignore on each node of the breakpoint
+func SetBreakpointIgnoreCount(id int, count int) {
+	breakpointTable.mu.Lock()
+	defer breakpointTable.mu.Unlock()
+
+	if entry := breakpointTable.entries[id]; entry != nil {
+		for _, nodeId := range entry.NodeIds {
+			entry.IgnoreCounts[nodeId] = count
+		}
+	}
+}
+
+// Hits are not recorded while reverse execution replays the program
+func SetBreakpointHitRecording(recording bool) {
+	breakpointTable.mu.Lock()
+	defer breakpointTable.mu.Unlock()
+
+	breakpointTable.recordingHits = recording
+}
+
+func recordBreakpointHit(hit rpc.BreakpointHit) {
+	breakpointTable.mu.Lock()
+	defer breakpointTable.mu.Unlock()
+
+	entry := breakpointTable.entries[hit.BreakpointId]
+	if entry == nil || !breakpointTable.recordingHits {
+		return
+	}
+
+	entry.Hits[hit.NodeId]++
+
+	if hit.Ignored {
+		entry.IgnoreCounts[hit.NodeId]--
+		return
+	}
+
+	if entry.Spec.Temporary {
+		removeEntryNode(entry, hit.NodeId)
+	}
+}
+
+// Records the frame a watchpoint on a local is bound to on the node, or removes the watchpoint from the node when the frame returned
+func recordWatchpointScope(scope rpc.WatchpointScope) {
+	breakpointTable.mu.Lock()
+	defer breakpointTable.mu.Unlock()
+
+	entry := breakpointTable.entries[scope.BreakpointId]
+	if entry == nil {
+		return
+	}
+
+	if scope.Frame != 0 {
+		entry.WatchFrames[scope.NodeId] = scope.Frame
+	} else {
+		removeEntryNode(entry, scope.NodeId)
+	}
+}
+
+// Removes the breakpoint from the node, and from the table once it is left on no node
+func removeEntryNode(entry *BreakpointEntry, removedNodeId int) {
+	var nodeIds []int
+	for _, nodeId := range entry.NodeIds {
+		if nodeId != removedNodeId {
+			nodeIds = append(nodeIds, nodeId)
+		}
+	}
+	entry.NodeIds = nodeIds
+
+	if len(entry.NodeIds) == 0 {
+		delete(breakpointTable.entries, entry.Id)
+	}
+}
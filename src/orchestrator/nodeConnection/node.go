@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/mihkeltiks/rev-mpi-deb/logger"
 	"github.com/mihkeltiks/rev-mpi-deb/rpc"
@@ -12,18 +13,25 @@ import (
 )
 
 type node struct {
-	id             int
+	id             int // internal, assigned in registration order
+	rank           int // MPI_COMM_WORLD rank of the process, -1 until known
 	pid            int
+	port           int // port of the rpc server of the node debugger
 	client         *rpc.RPCClient
 	pendingCommand *command.Command
-	Breakpoint     int
+	Breakpoint     int // id of the breakpoint the node last stopped at, CounterTargetStop at its statement counter target
 	pending        bool
 	counter        int
-	breakpoints    []int
+	breakpoints    []command.Breakpoint
+	backtrace      *rpc.NodeBacktrace    // last call stack reported by the node
+	location       *rpc.VariableLocation // last variable located by the node
+	awaitedResults int                   // number of dispatched commands the node has not yet reported a result for
+	supervised     bool                  // runs a continue the orchestrator interrupts for automatic checkpoints
+	interrupted    bool                  // the supervised continue is interrupted and waits to be resumed
 }
 
 func (n node) getConnection() *rpc.RPCClient {
-	nodeAddress, _ := url.Parse(fmt.Sprintf("localhost:%d", 3500+n.id))
+	nodeAddress, _ := url.Parse(fmt.Sprintf("localhost:%d", n.port))
 
 	return rpc.Connect(nodeAddress)
 }
@@ -52,14 +60,60 @@ func SaveRegisteredNodes() {
 	}
 }
 
-func SetBreakpoints(bps []int) {
-	registeredNodes.nodes[bps[0]].breakpoints = bps[1:]
+func SetBreakpoints(report *rpc.NodeBreakpoints) {
+	registeredNodes.nodes[report.NodeId].breakpoints = report.Breakpoints
 }
 
-func GetBreakpoints(NodeId int) []int {
+func GetBreakpoints(NodeId int) []command.Breakpoint {
 	return registeredNodes.nodes[NodeId].breakpoints
 }
 
+func SetBacktrace(report *rpc.NodeBacktrace) {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+	registeredNodes.nodes[report.NodeId].backtrace = report
+}
+
+// Returns the call stack last reported by the node, nil if none was reported since the last reset
+func GetBacktrace(id int) *rpc.NodeBacktrace {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	if node := registeredNodes.nodes[id]; node != nil {
+		return node.backtrace
+	}
+	return nil
+}
+
+func ResetBacktraces() {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	for _, node := range registeredNodes.nodes {
+		node.backtrace = nil
+	}
+}
+
+func SetVariableLocation(location *rpc.VariableLocation) {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+	registeredNodes.nodes[location.NodeId].location = location
+}
+
+// Returns the variable last located by the node and clears it, nil if none was reported
+func TakeVariableLocation(id int) *rpc.VariableLocation {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	node := registeredNodes.nodes[id]
+	if node == nil {
+		return nil
+	}
+	location := node.location
+	node.location = nil
+	return location
+}
+
 func GetRegisteredIds() []int {
 	nodeIds := make([]int, 0, len(registeredNodes.nodes))
 	for nodeId := range registeredNodes.nodes {
@@ -69,17 +123,116 @@ func GetRegisteredIds() []int {
 	return nodeIds
 }
 
+// Returns the ranks of the registered nodes, in ascending order
+func GetRegisteredRanks() []int {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	ranks := make([]int, 0, len(registeredNodes.nodes))
+	for _, node := range registeredNodes.nodes {
+		ranks = append(ranks, node.displayRank())
+	}
+	sort.Ints(ranks)
+	return ranks
+}
+
+// The rank of the node, or its id while the rank is unknown
+func (n *node) displayRank() int {
+	if n.rank < 0 {
+		return n.id
+	}
+	return n.rank
+}
+
+func SetNodeRank(id int, rank int) {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	node := registeredNodes.nodes[id]
+	if node == nil || node.rank == rank {
+		return
+	}
+
+	if node.rank >= 0 {
+		logger.Warn("process reported as rank %d now reports rank %d", node.rank, rank)
+	}
+	node.rank = rank
+}
+
+// Returns the rank of the node with the given id, for showing to the user
+func RankOfNode(id int) int {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	if node := registeredNodes.nodes[id]; node != nil {
+		return node.displayRank()
+	}
+	return id
+}
+
+func nodeIdOfRank(rank int) (int, error) {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	for _, node := range registeredNodes.nodes {
+		if node.displayRank() == rank {
+			return node.id, nil
+		}
+	}
+	return -1, fmt.Errorf("rank %d not found", rank)
+}
+
+// Commands entered by the user address ranks, this converts them to the node ids used internally
+func ResolveRanks(cmd *command.Command) error {
+	if cmd.NodeId >= 0 {
+		nodeId, err := nodeIdOfRank(cmd.NodeId)
+		if err != nil {
+			return err
+		}
+		cmd.NodeId = nodeId
+	}
+
+	if cmd.NodeId == command.NodeSet {
+		nodeIds := make([]int, len(cmd.NodeIds))
+		for index, rank := range cmd.NodeIds {
+			nodeId, err := nodeIdOfRank(rank)
+			if err != nil {
+				return err
+			}
+			nodeIds[index] = nodeId
+		}
+		cmd.NodeIds = nodeIds
+	}
+
+	return nil
+}
+
+// Returns the ids of the nodes the command is addressed to
+func TargetNodeIds(cmd *command.Command) []int {
+	switch cmd.NodeId {
+	case command.AllNodes:
+		return GetRegisteredIds()
+	case command.NodeSet:
+		return append([]int{}, cmd.NodeIds...)
+	default:
+		return []int{cmd.NodeId}
+	}
+}
+
+// Breakpoint of a node stopped at its statement counter target during reverse execution
+const CounterTargetStop = -5
+
 func GetNodeBreakpoint(id int) int {
 	registeredNodes.mu.Lock()
 	defer registeredNodes.mu.Unlock()
 	return registeredNodes.nodes[id].Breakpoint
 }
 
-func SetNodeBreakpoint(id int, line int) {
+func SetNodeBreakpoint(id int, breakpointId int) {
 	registeredNodes.mu.Lock()
 	defer registeredNodes.mu.Unlock()
 	// logger.Verbose("%v", registeredNodes.nodes)
-	registeredNodes.nodes[id].Breakpoint = line
+	registeredNodes.nodes[id].Breakpoint = breakpointId
 }
 
 func SetNodeCounter(id int, counter int) {
@@ -141,6 +294,20 @@ func GetReadyNode() int {
 	return -1
 }
 
+// Returns the id of a node among the given ones that is not executing a command, or -1 if all are busy
+func GetReadyNodeOf(ids []int) int {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	for _, id := range ids {
+		if node := registeredNodes.nodes[id]; node != nil && !node.pending {
+			return node.id
+		}
+	}
+
+	return -1
+}
+
 func GetNodesPending(ids []int) bool {
 	registeredNodes.mu.Lock()
 	defer registeredNodes.mu.Unlock()
@@ -227,3 +394,125 @@ func DisconnectAllNodes() {
 func GetRegisteredNodesLen() int {
 	return len(registeredNodes.nodes)
 }
+
+func addAwaitedResult(id int, delta int) {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	node := registeredNodes.nodes[id]
+	if node == nil {
+		return
+	}
+
+	node.awaitedResults += delta
+	if node.awaitedResults < 0 {
+		// the result of a command dispatched before a reconnect
+		node.awaitedResults = 0
+	}
+}
+
+// Whether any of the nodes has not yet reported the result of a command dispatched to it
+func HasAwaitedResults(ids []int) bool {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	for _, id := range ids {
+		if node := registeredNodes.nodes[id]; node != nil && node.awaitedResults > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocks until the nodes have reported the results of the commands dispatched to them.
+// A node reports only after its command finishes, so a timeout other than 0 gives up waiting, returns whether all results arrived
+func WaitForCommandResults(ids []int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for HasAwaitedResults(ids) {
+		if timeout > 0 && time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// Marks the nodes not running a command as running a supervised continue, which is dispatched to them next.
+// Returns the ids of the marked nodes, nodes still running earlier commands are left unsupervised
+func SuperviseNodes(ids []int) []int {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	supervised := []int{}
+	for _, id := range ids {
+		if node := registeredNodes.nodes[id]; node != nil && node.awaitedResults == 0 {
+			node.supervised = true
+			node.interrupted = false
+			supervised = append(supervised, id)
+		}
+	}
+	return supervised
+}
+
+// Returns the ids of the nodes running a supervised continue and of those whose supervised continue is interrupted
+func SupervisedNodes() (running []int, interrupted []int) {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	for _, id := range sortedIds(registeredNodes.nodes) {
+		node := registeredNodes.nodes[id]
+		if node.interrupted {
+			interrupted = append(interrupted, id)
+		} else if node.supervised {
+			running = append(running, id)
+		}
+	}
+	return running, interrupted
+}
+
+// Whether the nodes run no commands other than supervised continues, which can be interrupted for a checkpoint
+func OnlySupervisedCommandsRunning() bool {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	for _, node := range registeredNodes.nodes {
+		if node.awaitedResults > 1 || (node.awaitedResults == 1 && !node.supervised) {
+			return false
+		}
+	}
+	return true
+}
+
+// Records the interruption of the supervised continue of the node, returns false if the node does not run one
+func interruptSupervised(id int) bool {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	node := registeredNodes.nodes[id]
+	if node == nil || !node.supervised {
+		return false
+	}
+	node.interrupted = true
+	return true
+}
+
+// Records the end of the supervised continue of the node
+func endSupervision(id int) {
+	registeredNodes.mu.Lock()
+	defer registeredNodes.mu.Unlock()
+
+	if node := registeredNodes.nodes[id]; node != nil {
+		node.supervised = false
+		node.interrupted = false
+	}
+}
+
+func sortedIds(nodes nodeMap) []int {
+	ids := make([]int, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
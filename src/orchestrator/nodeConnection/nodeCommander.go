@@ -12,9 +12,12 @@ import (
 
 func HandleRemotely(cmd *command.Command) error {
 	nodeId := cmd.NodeId
-	if nodeId == -1 {
+	if nodeId == command.AllNodes {
 		return GlobalHandleRemotely(cmd)
 	}
+	if nodeId == command.NodeSet {
+		return handleOnNodeSet(cmd)
+	}
 
 	node := registeredNodes.nodes[nodeId]
 
@@ -26,10 +29,12 @@ func HandleRemotely(cmd *command.Command) error {
 	if len(registeredNodes.nodes) > 0 && cmd.IsForwardProgressCommand() {
 		SetNodePending(node.id)
 	}
+	addAwaitedResult(node.id, 1)
 
 	err := node.client.Call("RemoteCmdHandler.Handle", cmd, new(int))
 
 	if err != nil {
+		addAwaitedResult(node.id, -1)
 		logger.Error("Error dispatching command: %v", err)
 		return err
 	}
@@ -48,9 +53,11 @@ func GlobalHandleRemotely(cmd *command.Command) (err error) {
 			if len(registeredNodes.nodes) > 0 && cmd.IsForwardProgressCommand() {
 				SetNodePending(node.id)
 			}
+			addAwaitedResult(node.id, 1)
 
 			err := node.client.Call("RemoteCmdHandler.Handle", newCmd, new(int))
 			if err != nil {
+				addAwaitedResult(node.id, -1)
 				logger.Error("Error dispatching command: %v", err)
 				return err
 			}
@@ -62,6 +69,58 @@ func GlobalHandleRemotely(cmd *command.Command) (err error) {
 	return nil
 }
 
+// Fans a command addressed to a set of nodes out to each node of the set
+func handleOnNodeSet(cmd *command.Command) error {
+	for _, nodeId := range cmd.NodeIds {
+		newCmd := command.Command{NodeId: nodeId, Code: cmd.Code, Argument: cmd.Argument, Result: cmd.Result}
+
+		err := HandleRemotely(&newCmd)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Has a node running a command serve the request without waiting for the command to finish.
+// Returns false if the node is not running one, the request is then to be handled as a command
+func InterruptRemotely(nodeId int, request command.CommandCode) bool {
+	node := registeredNodes.nodes[nodeId]
+
+	if node == nil || !HasAwaitedResults([]int{nodeId}) {
+		return false
+	}
+
+	reply := 0
+	if err := node.client.Call("RemoteCmdHandler.Interrupt", request, &reply); err != nil {
+		logger.Error("Error interrupting node %d: %v", nodeId, err)
+		return false
+	}
+
+	return reply == 1
+}
+
+// Resumes the interrupted supervised continue of the node. The result of the continue is awaited already
+func ResumeRemotely(nodeId int) error {
+	node := registeredNodes.nodes[nodeId]
+	if node == nil {
+		return fmt.Errorf("Node %d not found", nodeId)
+	}
+
+	registeredNodes.mu.Lock()
+	node.interrupted = false
+	registeredNodes.mu.Unlock()
+
+	err := node.client.Call("RemoteCmdHandler.Handle", &command.Command{NodeId: nodeId, Code: command.Cont, Argument: command.SupervisedCont}, new(int))
+	if err != nil {
+		endSupervision(nodeId)
+		addAwaitedResult(nodeId, -1)
+		logger.Error("Error resuming node %d: %v", nodeId, err)
+	}
+	return err
+}
+
 func Reset() (err error) {
 	for _, node := range registeredNodes.nodes {
 		if node.client != nil {
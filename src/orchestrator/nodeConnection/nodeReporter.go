@@ -20,7 +20,7 @@ func NewNodeReporter(checkpointRecordChan chan<- rpc.MPICallRecord, quit func())
 	return &NodeReporter{sync.Mutex{}, checkpointRecordChan, quit}
 }
 
-func (r *NodeReporter) Register(pid *int, reply *int) error {
+func (r *NodeReporter) Register(registration *rpc.NodeRegistration, reply *int) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -29,7 +29,7 @@ func (r *NodeReporter) Register(pid *int, reply *int) error {
 	// Make sure new indexes are correct
 	if len(registeredNodesSave.nodes) > 0 {
 		for index, node := range registeredNodesSave.nodes {
-			if node.pid == *pid {
+			if node.pid == registration.Pid {
 				id = index
 				break
 			}
@@ -38,12 +38,15 @@ func (r *NodeReporter) Register(pid *int, reply *int) error {
 
 	node := node{
 		id:         id,
-		pid:        *pid,
+		rank:       registration.Rank,
+		pid:        registration.Pid,
+		port:       registration.Port,
 		Breakpoint: -1,
 		counter:    -1,
 	}
 
 	registeredNodes.nodes[node.id] = &node
+	logger.Verbose("rank %d registered, its debugger listening on port %d", node.rank, node.port)
 	// logger.Verbose("added process %d (pid: %d) to process list", node.id, node.pid)
 
 	*reply = node.id
@@ -60,10 +63,21 @@ func (r *NodeReporter) CommandResult(cmd *command.Command, reply *int) error {
 	// defer registeredNodes.mu.Unlock()
 	nodeId := cmd.NodeId
 
+	if cmd.Result.Interrupted && interruptSupervised(nodeId) {
+		// the continue goes on once resumed, its result is still awaited
+		return nil
+	}
+	if cmd.Code == command.Cont {
+		endSupervision(nodeId)
+	}
+
+	addAwaitedResult(nodeId, -1)
+	recordCommandResult(cmd)
+
 	if len(cmd.Result.Error) > 0 {
 		logger.Warn(
-			"Node %v reported an error while executing command: %v",
-			nodeId, cmd.Result.Error,
+			"Rank %v reported an error while executing command: %v",
+			RankOfNode(nodeId), cmd.Result.Error,
 		)
 	} else {
 		if len(registeredNodes.nodes) > 0 && cmd.IsForwardProgressCommand() {
@@ -73,7 +87,7 @@ func (r *NodeReporter) CommandResult(cmd *command.Command, reply *int) error {
 	}
 
 	if cmd.Result.Exited {
-		logger.Info("Node %v exited", nodeId)
+		logger.Info("Rank %v exited", RankOfNode(nodeId))
 
 		delete(registeredNodes.nodes, nodeId)
 
@@ -89,8 +103,60 @@ func (r *NodeReporter) CommandResult(cmd *command.Command, reply *int) error {
 	return nil
 }
 
-func (r *NodeReporter) Breakpoint(info *command.Command, reply *int) error {
-	SetNodeBreakpoint(info.NodeId, int(info.Code))
+// The outcome of a command executed on a node
+type NodeCommandResult struct {
+	NodeId  int
+	Rank    int
+	Command command.Command
+	Error   string
+	Exited  bool
+}
+
+var commandResults struct {
+	mu      sync.Mutex
+	results []NodeCommandResult
+}
+
+func recordCommandResult(cmd *command.Command) {
+	commandResults.mu.Lock()
+	defer commandResults.mu.Unlock()
+
+	commandResults.results = append(commandResults.results, NodeCommandResult{
+		NodeId:  cmd.NodeId,
+		Rank:    RankOfNode(cmd.NodeId),
+		Command: command.Command{NodeId: cmd.NodeId, Code: cmd.Code, Argument: cmd.Argument},
+		Error:   cmd.Result.Error,
+		Exited:  cmd.Result.Exited,
+	})
+}
+
+// Returns the command results reported by nodes since the last call
+func TakeCommandResults() []NodeCommandResult {
+	commandResults.mu.Lock()
+	defer commandResults.mu.Unlock()
+
+	results := commandResults.results
+	commandResults.results = nil
+
+	return results
+}
+
+func (r *NodeReporter) Breakpoint(stop rpc.BreakpointStop, reply *int) error {
+	if stop.CounterTarget {
+		SetNodeBreakpoint(stop.NodeId, CounterTargetStop)
+	} else {
+		SetNodeBreakpoint(stop.NodeId, stop.BreakpointId)
+	}
+	return nil
+}
+
+func (r *NodeReporter) BreakpointHit(hit rpc.BreakpointHit, reply *int) error {
+	recordBreakpointHit(hit)
+	return nil
+}
+
+func (r *NodeReporter) WatchpointScope(scope rpc.WatchpointScope, reply *int) error {
+	recordWatchpointScope(scope)
 	return nil
 }
 
@@ -101,8 +167,18 @@ func (r *NodeReporter) ReportCounter(info *command.Command, reply *int) error {
 	return nil
 }
 
-func (r *NodeReporter) ReportBreakpoints(breakpoints *[]int, nodeId *int) error {
-	SetBreakpoints(*breakpoints)
+func (r *NodeReporter) ReportBreakpoints(report *rpc.NodeBreakpoints, reply *int) error {
+	SetBreakpoints(report)
+	return nil
+}
+
+func (r *NodeReporter) ReportBacktrace(report *rpc.NodeBacktrace, reply *int) error {
+	SetBacktrace(report)
+	return nil
+}
+
+func (r *NodeReporter) ReportVariableLocation(location *rpc.VariableLocation, reply *int) error {
+	SetVariableLocation(location)
 	return nil
 }
 
@@ -112,6 +188,9 @@ func (r *NodeReporter) Progress(cmd *command.Command, reply *int) error {
 }
 
 func (r *NodeReporter) MPICall(callRecord rpc.MPICallRecord, reply *int) error {
+	if callRecord.Rank >= 0 {
+		SetNodeRank(callRecord.NodeId, callRecord.Rank)
+	}
 	r.checkpointRecordChan <- callRecord
 	return nil
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -29,75 +30,100 @@ import (
 
 var NODE_DEBUGGER_PATH = fmt.Sprintf("%s/node-debugger", utils.GetExecutableDir())
 
-const ORCHESTRATOR_PORT = 3490
+var config *cli.Config
 
 var checkpoints []string
 var rootCheckpointTree checkpointmanager.CheckpointTree
 var currentCheckpointTree *checkpointmanager.CheckpointTree
 var currentCommandlog checkpointmanager.CommandLog
+var currentBranch = checkpointmanager.MainBranch // empty after restoring a checkpoint in the middle of a branch
 
 var pid int
 var numProcesses int
 var program string
 var dmtcpImgDir string
+var sessionDir string
+var exitCode int
 
 func main() {
-	logger.SetMaxLogLevel(logger.Levels.Verbose)
-	numProcessesCLI, targetPath, programloc := cli.ParseArgs()
-	program=programloc
-	numProcesses = numProcessesCLI
+	config = cli.ParseArgs()
+	logger.SetMaxLogLevel(config.MaxLogLevel())
+	targetPath := config.Target
+	program = config.Backend
+	numProcesses = config.NumProcesses
+
+	if config.Script != "" {
+		script, err := cli.LoadScript(config.Script)
+		if err != nil {
+			logger.Error("cannot load script: %v", err)
+			os.Exit(2)
+		}
+		cli.UseScript(script)
+	}
+
+	if err := os.MkdirAll(config.CheckpointDir, 0750); err != nil {
+		logger.Error("cannot create checkpoint directory: %v", err)
+		os.Exit(1)
+	}
+
+	// checkpoint images and temporary files of this session are kept apart from other sessions running on the machine
+	var err error
+	sessionDir, err = os.MkdirTemp(config.CheckpointDir, "session-*")
+	if err != nil {
+		logger.Error("cannot create session directory: %v", err)
+		os.Exit(1)
+	}
+	// node debuggers clear their temp dir on startup, so they get one of their own
+	nodeTempDir := fmt.Sprintf("%v/nodes", sessionDir)
+	if err := os.Mkdir(nodeTempDir, 0750); err != nil {
+		logger.Error("cannot create node temp directory: %v", err)
+		os.Exit(1)
+	}
 
 	// start goroutine for collecting checkpoint results
 	checkpointRecordChan := make(chan rpc.MPICallRecord)
 	go startCheckpointRecordCollector(checkpointRecordChan)
 
 	// start rpc server in separate goroutine
+	listener := rpc.Listen(config.OrchestratorPort)
+	orchestratorAddress := fmt.Sprintf("localhost:%d", rpc.ListenerPort(listener))
+	logger.Verbose("orchestrator listening on %v, session directory %v", orchestratorAddress, sessionDir)
+
 	go func() {
-		rpc.InitializeServer(ORCHESTRATOR_PORT, func(register rpc.Registrator) {
+		rpc.Serve(listener, func(register rpc.Registrator) {
 			register(new(logger.LoggerServer))
 			register(nodeconnection.NewNodeReporter(checkpointRecordChan, quit))
 		})
 	}()
 
-	time.Sleep(1 * time.Second) 
-
 	logger.Info("executing %v as an mpi job with %d processes", targetPath, numProcesses)
 
 	var mpiProcess *exec.Cmd
-	var err error
 	var c *criu.Criu
 	// Start the MPI job
-	if program=="criu"{
+	mpirunArgs := append([]string{"mpirun", "-np", fmt.Sprintf("%d", numProcesses)}, config.MpirunArgs...)
+	mpirunArgs = append(mpirunArgs, config.NodeDebuggerArgs(NODE_DEBUGGER_PATH, orchestratorAddress, nodeTempDir)...)
+
+	if program==cli.CRIU_BACKEND{
 		c = criu.MakeCriu()
-		mpiProcess = exec.Command(
-			"mpirun",
-			"-np",
-			fmt.Sprintf("%d", numProcesses),
-			NODE_DEBUGGER_PATH,
-			targetPath,
-			fmt.Sprintf("localhost:%d", ORCHESTRATOR_PORT),
-		)
+		mpiProcess = exec.Command(mpirunArgs[0], mpirunArgs[1:]...)
 		dmtcpImgDir=""
-	}else if(program=="dmtcp"){
-		dmtcpImgDir=fmt.Sprintf("%v/temp/dmtcp", utils.GetExecutableDir())
-		if _, err := os.Stat(dmtcpImgDir); os.IsNotExist(err) {
-			err := os.Mkdir(dmtcpImgDir, 0750)
-			if err != nil {
-				logger.Error("trying to create temp/dmtcp: %v", err)
-				os.Exit(1)
-			}
+	}else if(program==cli.DMTCP_BACKEND){
+		dmtcpImgDir=fmt.Sprintf("%v/dmtcp", sessionDir)
+		err := os.Mkdir(dmtcpImgDir, 0750)
+		if err != nil {
+			logger.Error("trying to create %v: %v", dmtcpImgDir, err)
+			os.Exit(1)
 		}
 		mpiProcess = exec.Command(
 			"dmtcp_launch",
-			"--ckptdir",
-			dmtcpImgDir,
-			"mpirun",
-			"-np",
-			fmt.Sprintf("%d", numProcesses),
-			NODE_DEBUGGER_PATH,
-			targetPath,
-			fmt.Sprintf("localhost:%d", ORCHESTRATOR_PORT),
-		)	
+			append([]string{
+				"--ckptdir", dmtcpImgDir,
+				"--new-coordinator",
+				"--coord-port", fmt.Sprint(config.DmtcpPort),
+				"--port-file", dmtcpPortFile(),
+			}, mpirunArgs...)...,
+		)
 	}
 
 	//fmt.Printf("%#v",mpiProcess)
@@ -115,11 +141,15 @@ func main() {
 
 	// start the graphical user interface
 	// when running with docker, gui must be started on the host
+	// headless sessions still serve the websocket, a gui started separately can connect to it
 	if !utils.IsRunningInContainer() {
-		gui.Start()
+		websocketPort := websocket.InitServer(config.GuiPort)
 
-		websocket.InitServer()
-		websocket.WaitForClientConnection()
+		if !config.Headless && !cli.IsScriptMode() {
+			gui.Start(websocketPort, config.GuiHttpPort)
+
+			websocket.WaitForClientConnection()
+		}
 	}
 
 	// asyncronously wait for the MPI job to finish
@@ -139,6 +169,10 @@ func main() {
 	wg.Wait()
 	nodeconnection.SaveRegisteredNodes()
 
+	if program == cli.DMTCP_BACKEND {
+		logger.Verbose("dmtcp coordinator listening on port %v", dmtcpCoordinatorPort())
+	}
+
 	pid = mpiProcess.Process.Pid
 
 	checkpointDir := checkpoint(c)
@@ -153,75 +187,183 @@ func main() {
 		[]*checkpointmanager.CheckpointTree{},
 		checkpointDir,
 		nil,
-		make([]int, numProcesses))
+		make([]int, numProcesses),
+		checkpointmanager.MainBranch)
 
 	currentCheckpointTree = &rootCheckpointTree
 
-	cli.PrintInstructions()
+	for _, cmd := range config.InitialBreakpoints() {
+		executeCommand(cmd, c)
+	}
+	nodeconnection.TakeCommandResults()
+
+	if autoCheckpointing() {
+		go superviseAutoCheckpoints(c)
+	}
+
+	if !cli.IsScriptMode() {
+		cli.PrintInstructions()
+	}
 	for {
 		cmd := cli.AskForInput()
-		if cmd.Code == command.Cont || cmd.Code == command.SingleStep || cmd.Code == command.Bpoint {
-			currentCommandlog = append(currentCommandlog, *cmd)
+		executeCommand(cmd, c)
+
+		results := nodeconnection.TakeCommandResults()
+		if cli.IsScriptMode() {
+			reportScriptCommandResults(cmd, results)
 		}
-		switch cmd.Code {
-		case command.Quit:
-			quit()
-		case command.Help:
-			cli.PrintInstructions()
-		case command.ListCheckpoints:
-			checkpointmanager.ListCheckpoints()
-		case command.GlobalRollback:
-			handleRollbackSubmission(cmd)
-		case command.Checkpoint:
-			checkpointDir = checkpoint(c)
-
-			checkpoints = append(checkpoints, checkpointDir)
-			//fmt.Println(checkpoints)
-			checkpointmanager.AddCheckpointLog()
-
-			websocket.HandleCriuCheckpoint()
-
-			currentCheckpointTree = checkpointmanager.MakeCheckpointTree(
-				checkpointmanager.GetCheckpointLog(),
-				currentCheckpointTree,
-				[]*checkpointmanager.CheckpointTree{},
-				checkpointDir,
-				currentCommandlog,
-				nodeconnection.GetAllNodeCounters())
-
-			currentCheckpointTree.GetParentTree().AddChildTree(currentCheckpointTree)
-
-			currentCommandlog = []command.Command{}
-
-		case command.GRestore:
-			index := cmd.Argument.(int)
-
-			restore(checkpoints[index], pid, numProcesses)
-
-			websocket.HandleCriuRestore(index)
-			checkpointmanager.SetCheckpointLog(index)
-
-			currentCheckpointTree = findTreeByDir(&rootCheckpointTree, checkpoints[index])
-			currentCommandlog = []command.Command{}
-
-			var wg sync.WaitGroup
-			wg.Add(1)
-			connectBackToNodes(numProcesses, true, &wg)
-			wg.Wait()
-
-		case command.ReverseSingleStep:
-			calculateReverseStepCommands(cmd)
-		case command.ReverseCont:
-			calculateReverseContinueCommands(cmd)
-		default:
-			nodeconnection.HandleRemotely(cmd)
-			time.Sleep(time.Second)
+	}
+}
+
+func executeCommand(cmd *command.Command, c *criu.Criu) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+
+	if cmd.IsNodeCommand() {
+		if err := nodeconnection.ResolveRanks(cmd); err != nil {
+			logger.Warn("%v", err)
+			return
 		}
 	}
+
+	if cmd.IsForwardProgressCommand() {
+		checkpointChangedVariables(c)
+	}
+	if cmd.IsForwardProgressCommand() || cmd.Code == command.Bpoint || cmd.Code == command.SetVariable {
+		currentCommandlog = append(currentCommandlog, *cmd)
+	}
+	if cmd.Code == command.SetVariable {
+		variablesChanged = true
+	}
+	switch cmd.Code {
+	case command.Quit:
+		quit()
+	case command.Help:
+		cli.PrintInstructions()
+	case command.ListCheckpoints:
+		checkpointmanager.ListCheckpoints()
+	case command.GlobalRollback:
+		handleRollbackSubmission(cmd)
+	case command.Group:
+		if group, ok := cmd.Argument.(cli.RankGroup); ok {
+			cli.DefineRankGroup(group)
+		} else {
+			cli.PrintRankGroups()
+		}
+	case command.ListBreakpoints:
+		cli.PrintBreakpoints()
+	case command.Bpoint:
+		setBreakpoint(cmd)
+	case command.DeleteBreakpoint:
+		deleteBreakpoints(cmd.Argument.([]int))
+	case command.DisableBreakpoint:
+		enableBreakpoints(cmd.Argument.([]int), false)
+	case command.EnableBreakpoint:
+		enableBreakpoints(cmd.Argument.([]int), true)
+	case command.IgnoreBreakpoint:
+		arguments := cmd.Argument.([]int)
+		ignoreBreakpoint(arguments[0], arguments[1])
+	case command.Checkpoint:
+		takeCheckpoint(c, checkpointBranch())
+
+	case command.GRestore:
+		tree, err := resolveCheckpoint(cmd.Argument.(string))
+		if err != nil {
+			logger.Warn("%v", err)
+			return
+		}
+		restoreCheckpointTree(tree)
+
+	case command.Branch:
+		createBranch(c, cmd.Argument.(string))
+	case command.ListBranches:
+		printBranches()
+	case command.SwitchBranch:
+		switchBranch(cmd.Argument.(string))
+	case command.CompareBranches:
+		names := cmd.Argument.([]string)
+		compareBranches(names[0], names[1])
+	case command.PrintTree:
+		printCheckpointTree()
+	case command.Label:
+		labelCheckpoint(cmd.Argument.(string))
+	case command.DeleteCheckpoint:
+		deleteCheckpoint(cmd.Argument.(string))
+
+	case command.LastChange:
+		if cmd.NodeId < 0 {
+			logger.Warn("rwatch-last goes back on a single rank")
+			return
+		}
+		goToLastChange(cmd)
+	case command.ReverseFinish:
+		if cmd.NodeId < 0 {
+			logger.Warn("reverse-finish goes back on a single rank")
+			return
+		}
+		goToCallSite(cmd)
+	case command.Backtrace:
+		nodeIds := nodeconnection.TargetNodeIds(cmd)
+		collectBacktraces(nodeIds)
+		if len(nodeIds) > 1 && !cmd.Argument.(bool) {
+			cli.PrintMergedBacktraces(nodeIds)
+		} else {
+			cli.PrintBacktraces(nodeIds)
+		}
+	case command.ReverseSingleStep:
+		reverseStepLine(cmd, false)
+	case command.ReverseNext:
+		reverseStepLine(cmd, true)
+	case command.ReverseCont:
+		nodeconnection.SetBreakpointHitRecording(false)
+		calculateReverseContinueCommands(cmd)
+		nodeconnection.SetBreakpointHitRecording(true)
+	case command.Cont:
+		continueSupervised(cmd)
+	case command.Restore:
+		nodeconnection.HandleRemotely(cmd)
+		awaitCommandResults(nodeconnection.TargetNodeIds(cmd))
+		reapplyBreakpoints(nodeconnection.TargetNodeIds(cmd))
+	default:
+		nodeconnection.HandleRemotely(cmd)
+		awaitCommandResults(nodeconnection.TargetNodeIds(cmd))
+	}
+}
+
+// Waits for the nodes to report the results of the commands sent to them. Scripts run each command to its end,
+// interactive sessions return to the prompt after a second, as a node blocked in its command reports only when it stops,
+// possibly only after a command to another rank
+func awaitCommandResults(nodeIds []int) {
+	timeout := time.Second
+	if cli.IsScriptMode() {
+		timeout = 0
+	}
+	nodeconnection.WaitForCommandResults(nodeIds, timeout)
+}
+
+// Prints the outcome of a script command on each node, and marks the session as failed on errors
+func reportScriptCommandResults(cmd *command.Command, results []nodeconnection.NodeCommandResult) {
+	failed := false
+
+	for _, result := range results {
+		if len(result.Error) > 0 {
+			failed = true
+			fmt.Printf("  rank %d: %v failed: %s\n", result.Rank, result.Command, result.Error)
+		} else if result.Exited {
+			fmt.Printf("  rank %d: exited\n", result.Rank)
+		}
+	}
+
+	if failed {
+		exitCode = 1
+		fmt.Printf("result of %v: error\n", cmd)
+	} else {
+		fmt.Printf("result of %v: ok\n", cmd)
+	}
 }
 func createCpDir() *os.File {
 			//we create the checkpoint dir
-			imgDir, err := os.MkdirTemp(fmt.Sprintf("%v/temp", utils.GetExecutableDir()), "cp-*")
+			imgDir, err := os.MkdirTemp(sessionDir, "cp-*")
 		
 			if err != nil {
 				logger.Error("Error creating folder, %v", err)
@@ -247,72 +389,86 @@ func findTreeByDir(tree *checkpointmanager.CheckpointTree, dir string) *checkpoi
 	}
 	return nil
 }
-func calculateReverseStepCommands(cmd *command.Command) {
-	nodeconnection.HandleRemotely(&command.Command{NodeId: -1, Code: command.RetrieveBreakpoints})
-	nodeconnection.HandleRemotely(&command.Command{NodeId: -1, Code: command.Retrieve, Argument: "counter"})
-	counters := nodeconnection.GetAllNodeCounters()
 
-	for {
-		stop := true
+// Checkpoints the job as a child of the current checkpoint, on the branch
+func takeCheckpoint(c *criu.Criu, branch string) {
+	counters := retrieveCounters()
+	checkpointDir := checkpoint(c)
 
-		for _, counter := range counters {
-			if counter == -1 {
-				stop = false
-			}
-		}
-		if stop {
-			break
-		}
-		time.Sleep(50 * time.Millisecond)
-		counters = nodeconnection.GetAllNodeCounters()
-	}
-	bpmap := make(map[int][]int)
-	for i := 0; i < numProcesses; i++ {
-		bpmap[i] = nodeconnection.GetBreakpoints(i)
-	}
+	checkpoints = append(checkpoints, checkpointDir)
+	checkpointmanager.AddCheckpointLog()
+
+	websocket.HandleCriuCheckpoint()
 
-	// tree, _ := findTreeCandidateCounter(cmd, *currentCheckpointTree)
-	restore(rootCheckpointTree.GetCheckpointDir(), pid, numProcesses)
-	websocket.HandleCriuRestore(0)
-	checkpointmanager.SetCheckpointLog(0)
+	currentCheckpointTree = checkpointmanager.MakeCheckpointTree(
+		checkpointmanager.GetCheckpointLog(),
+		currentCheckpointTree,
+		[]*checkpointmanager.CheckpointTree{},
+		checkpointDir,
+		currentCommandlog,
+		counters,
+		branch)
 
-	var gg sync.WaitGroup
-	gg.Add(1)
-	connectBackToNodes(numProcesses, true, &gg)
-	gg.Wait()
+	currentCheckpointTree.GetParentTree().AddChildTree(currentCheckpointTree)
 
-	if cmd.NodeId == -1 {
-		for index := range counters {
-			counters[index] -= 1
-		}
-	} else {
-		counters[cmd.NodeId] -= 1
+	currentCommandlog = []command.Command{}
+	currentBranch = branch
+
+	resetForwardExecution()
+	variablesChanged = false
+}
+
+// The branch a checkpoint taken now is recorded on
+func checkpointBranch() string {
+	if currentBranch != "" {
+		return currentBranch
 	}
 
-	nodeconnection.HandleRemotely(&command.Command{NodeId: -1, Code: command.RemoveBreakpoints})
+	// continuing from a checkpoint restored in the middle of a branch forks a new one
+	branch := newBranchName(currentCheckpointTree.GetBranch())
+	logger.Info("recording the checkpoint on new branch %v", branch)
+	return branch
+}
 
-	for index, counter := range counters {
-		nodeconnection.HandleRemotely(&command.Command{NodeId: index, Code: command.Insert, Argument: counter})
-		nodeconnection.HandleRemotely(&command.Command{NodeId: index, Code: command.Cont})
+// Restores the job from the checkpoint. Restoring the latest checkpoint of a branch continues the branch,
+// restoring an earlier one leaves the job off any branch until it is checkpointed
+func restoreCheckpointTree(tree *checkpointmanager.CheckpointTree) {
+	index := checkpointIndex(tree.GetCheckpointDir())
+
+	restore(tree.GetCheckpointDir(), pid, numProcesses)
+
+	websocket.HandleCriuRestore(index)
+	checkpointmanager.SetCheckpointLog(index)
+
+	currentCheckpointTree = tree
+	currentCommandlog = []command.Command{}
+	resetForwardExecution()
+	variablesChanged = false
+
+	if tree.IsBranchTip() {
+		currentBranch = tree.GetBranch()
+	} else {
+		currentBranch = ""
+		logger.Info("restored checkpoint %d in the middle of branch %v, record changes made from here with branch <name>", index, tree.GetBranch())
 	}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go waitFinish(&wg)
+	connectBackToNodes(numProcesses, true, &wg)
 	wg.Wait()
+}
 
-	for index := range counters {
-		nodeconnection.HandleRemotely(&command.Command{NodeId: index, Code: command.Insert, Argument: 2000000})
-	}
-	for i := 0; i < numProcesses; i++ {
-		nodeconnection.HandleRemotely(&command.Command{NodeId: i, Code: command.ChangeBreakpoints, Argument: bpmap[i]})
+// The number of the checkpoint with the image directory, as listed by restore
+func checkpointIndex(dir string) int {
+	for index, checkpointDir := range checkpoints {
+		if checkpointDir == dir {
+			return index
+		}
 	}
-
-	nodeconnection.ResetAllNodeCounters()
+	return -1
 }
 
 func calculateReverseContinueCommands(cmd *command.Command) {
-	nodeconnection.HandleRemotely(&command.Command{NodeId: -1, Code: command.RetrieveBreakpoints})
 	nodeconnection.HandleRemotely(&command.Command{NodeId: -1, Code: command.Retrieve, Argument: "counter"})
 	counters := nodeconnection.GetAllNodeCounters()
 
@@ -331,40 +487,56 @@ func calculateReverseContinueCommands(cmd *command.Command) {
 		counters = nodeconnection.GetAllNodeCounters()
 	}
 
-	bpmap := make(map[int][]int)
+	// every hit whose condition holds is a candidate for going back to, regardless of ignore counts.
+	// Watchpoints are left out, the replay goes back to line breakpoints
+	bpmap := make(map[int][]command.Breakpoint)
 	for i := 0; i < numProcesses; i++ {
-		bpmap[i] = nodeconnection.GetBreakpoints(i)
+		for _, breakpoint := range nodeconnection.NodeBreakpoints(i) {
+			if breakpoint.Watch == "" {
+				breakpoint.IgnoreCount = 0
+				bpmap[i] = append(bpmap[i], breakpoint)
+			}
+		}
 	}
 
-	// tree, _ := findTreeCandidateCounter(cmd, *currentCheckpointTree)
-	breakpointHitMap := reverseContLoop(cmd, rootCheckpointTree.GetCheckpointDir(), counters, bpmap, nil, false)
-	reverseContLoop(cmd, rootCheckpointTree.GetCheckpointDir(), counters, bpmap, breakpointHitMap, true)
+	// the nodes run to the counters before their current ones, stopping only when their counter is incremented to it,
+	// so the replay starts from a checkpoint before those
+	before := make([]int, len(counters))
+	for index, counter := range counters {
+		before[index] = counter - 2
+	}
+	tree := findTreeCandidateCounter(before, currentCheckpointTree)
 
-	// Remove the breakpoint that was hit
-	for i := 0; i < numProcesses; i++ {
-		if cmd.NodeId == i || cmd.NodeId == -1 {
-			length := len(breakpointHitMap[i])
-			if length > 0 {
-				bpmap[i] = removeElement(bpmap[i], breakpointHitMap[i][length-1])
-			}
+	breakpointHitMap := reverseContLoop(cmd, tree, counters, bpmap, nil, false)
+
+	// hits before the checkpoint are not seen, a rank with breakpoints but without any hit after it looks for them from the checkpoints before.
+	// Ranks that found hits find the same last ones from an earlier checkpoint
+	searching := []int{}
+	for _, nodeId := range nodeconnection.TargetNodeIds(cmd) {
+		if len(bpmap[nodeId]) > 0 {
+			searching = append(searching, nodeId)
 		}
 	}
-	nodeconnection.HandleRemotely(&command.Command{NodeId: cmd.NodeId, Code: command.Insert, Argument: 2000000})
+	for tree.HasParent() && !hitOnEachNode(breakpointHitMap, searching) {
+		tree = findTreeCandidateCounter(before, tree.GetParentTree())
+		breakpointHitMap = reverseContLoop(cmd, tree, counters, bpmap, nil, false)
+	}
+
+	reverseContLoop(cmd, tree, counters, bpmap, breakpointHitMap, true)
+
+	nodeconnection.HandleRemotely(&command.Command{NodeId: cmd.NodeId, NodeIds: cmd.NodeIds, Code: command.Insert, Argument: 2000000})
+
+	// the replay leaves the nodes with breakpoints set for finding the hits
+	reapplyBreakpoints(nodeconnection.GetRegisteredIds())
 
 }
 
-func reverseContLoop(cmd *command.Command, checkpointDirRestore string, counters []int, bpmap map[int][]int, firstRunhitMap map[int][]int, secondRun bool) map[int][]int {
-	checkpointmanager.SetCheckpointLog(0)
-	websocket.HandleCriuRestore(0)
-	restore(checkpointDirRestore, pid, numProcesses)
-	var wg sync.WaitGroup
-	wg.Add(1)
-	connectBackToNodes(numProcesses, true, &wg)
-	wg.Wait()
+func reverseContLoop(cmd *command.Command, tree *checkpointmanager.CheckpointTree, counters []int, bpmap map[int][]command.Breakpoint, firstRunhitMap map[int][]int, secondRun bool) map[int][]int {
+	restoreForReplay(tree)
 	// Set new breakpoints
 	for i := 0; i < numProcesses; i++ {
 		nodeconnection.HandleRemotely(&command.Command{NodeId: i, Code: command.RemoveBreakpoints})
-		if cmd.NodeId == i || cmd.NodeId == -1 {
+		if cmd.TargetsNode(i) {
 			nodeconnection.HandleRemotely(&command.Command{NodeId: i, Code: command.ChangeBreakpoints, Argument: bpmap[i]})
 		}
 	}
@@ -378,25 +550,26 @@ func reverseContLoop(cmd *command.Command, checkpointDirRestore string, counters
 	for i := 0; i < numProcesses; i++ {
 		breakpointHitMap[i] = []int{}
 	}
-	if cmd.NodeId == -1 {
-		var unCompletedNodes []int
-		for i := 1; i < numProcesses; i++ {
-			unCompletedNodes = append(unCompletedNodes, i)
-		}
+	if cmd.NodeId == -1 || cmd.NodeId == command.NodeSet {
+		// the nodes outside a node set run to their counter target without stopping at breakpoints
+		unCompletedNodes := nodeconnection.TargetNodeIds(cmd)
 
 		for len(unCompletedNodes) != 0 {
-			node := nodeconnection.GetReadyNode()
+			node := nodeconnection.GetReadyNodeOf(unCompletedNodes)
 			for node == -1 {
 				time.Sleep(10 * time.Millisecond)
-				node = nodeconnection.GetReadyNode()
+				node = nodeconnection.GetReadyNodeOf(unCompletedNodes)
 			}
 			breakpointHit := nodeconnection.GetNodeBreakpoint(node)
 			if secondRun && len(breakpointHitMap[node]) == len(firstRunhitMap[node])-1 {
 				unCompletedNodes = removeElement(unCompletedNodes, node)
-			} else if !secondRun && breakpointHit == -5 {
+			} else if breakpointHit == nodeconnection.CounterTargetStop {
+				// at the counter target: every hit was seen, or in the second run the node had none to go back to
 				unCompletedNodes = removeElement(unCompletedNodes, node)
 			} else {
-				nodeconnection.HandleRemotely(&command.Command{NodeId: node, Code: command.Bpoint, Argument: -breakpointHit})
+				if breakpoint, found := reinsertedBreakpoint(bpmap[node], breakpointHit); found {
+					nodeconnection.HandleRemotely(&command.Command{NodeId: node, Code: command.Bpoint, Argument: breakpoint})
+				}
 				breakpointHitMap[node] = append(breakpointHitMap[node], breakpointHit)
 				nodeconnection.HandleRemotely(&command.Command{NodeId: node, Code: command.Cont, Argument: 1})
 			}
@@ -411,10 +584,12 @@ func reverseContLoop(cmd *command.Command, checkpointDirRestore string, counters
 
 			if secondRun && len(breakpointHitMap[cmd.NodeId]) == len(firstRunhitMap[cmd.NodeId])-1 {
 				break
-			} else if !secondRun && breakpointHit == -5 {
+			} else if breakpointHit == nodeconnection.CounterTargetStop {
 				break
 			} else {
-				nodeconnection.HandleRemotely(&command.Command{NodeId: cmd.NodeId, Code: command.Bpoint, Argument: -breakpointHit})
+				if breakpoint, found := reinsertedBreakpoint(bpmap[cmd.NodeId], breakpointHit); found {
+					nodeconnection.HandleRemotely(&command.Command{NodeId: cmd.NodeId, Code: command.Bpoint, Argument: breakpoint})
+				}
 				breakpointHitMap[cmd.NodeId] = append(breakpointHitMap[cmd.NodeId], breakpointHit)
 			}
 			nodeconnection.HandleRemotely(&command.Command{NodeId: cmd.NodeId, Code: command.Cont, Argument: 1})
@@ -423,6 +598,30 @@ func reverseContLoop(cmd *command.Command, checkpointDirRestore string, counters
 	return breakpointHitMap
 }
 
+func hitOnEachNode(breakpointHitMap map[int][]int, nodeIds []int) bool {
+	for _, nodeId := range nodeIds {
+		if len(breakpointHitMap[nodeId]) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the breakpoint with the id a node has stopped at, to insert again ignoring its first hit.
+// The location and condition are kept, so that nodes keep stopping only when the condition holds
+func reinsertedBreakpoint(breakpoints []command.Breakpoint, id int) (command.Breakpoint, bool) {
+	for _, breakpoint := range breakpoints {
+		if breakpoint.Id == id {
+			// a node stopped where a breakpoint is inserted passes it when continuing, whatever its location
+			if breakpoint.Line > 0 {
+				breakpoint.Line = -breakpoint.Line
+			}
+			return breakpoint, true
+		}
+	}
+	return command.Breakpoint{}, false
+}
+
 func removeElement(array []int, value int) []int {
 	// Initialize a new slice to hold the result
 	var result []int
@@ -447,32 +646,26 @@ func waitFinish(wg *sync.WaitGroup) {
 	// logger.Verbose("DONE WAIT FINISH")
 }
 
-func checkCounters(counters []int, nodeId int) bool {
-	currentCounters := nodeconnection.GetAllNodeCounters()
-	if nodeId == -1 {
-		for index, counter := range counters {
-			if currentCounters[index]-counter == 0 {
-				return false
-			}
+// Whether a node at the counters has not yet passed any of the target counters
+func countersAtOrBefore(counters []int, targets []int) bool {
+	for index, target := range targets {
+		if index < len(counters) && counters[index] > target {
+			return false
 		}
-		return true
 	}
-	return currentCounters[nodeId]-counters[nodeId] > 0
-
+	return true
 }
-func findTreeCandidateCounter(cmd *command.Command, tree checkpointmanager.CheckpointTree) (result checkpointmanager.CheckpointTree, counters []int) {
-	if checkCounters(currentCheckpointTree.GetCounters(), cmd.NodeId) {
-		return *currentCheckpointTree, currentCheckpointTree.GetCounters()
-	}
-	tree.Print()
-	for tree.HasParent() {
-		tree = *tree.GetParentTree()
-		if checkCounters(tree.GetCounters(), cmd.NodeId) {
-			return tree, tree.GetCounters()
-		}
 
+// Finds the checkpoint replays to the counters start from: the latest one on the way from the tree back to the root
+// whose counters are all at or before them, the root if there is none.
+// Replaying from it instead of the root keeps reverse execution late in a long run short
+func findTreeCandidateCounter(counters []int, tree *checkpointmanager.CheckpointTree) *checkpointmanager.CheckpointTree {
+	for ; tree.HasParent(); tree = tree.GetParentTree() {
+		if countersAtOrBefore(tree.GetCounters(), counters) {
+			return tree
+		}
 	}
-	return tree, nil
+	return tree
 }
 
 func connectBackToNodes(numProcesses int, attach bool, wg *sync.WaitGroup) {
@@ -483,6 +676,7 @@ func connectBackToNodes(numProcesses int, attach bool, wg *sync.WaitGroup) {
 	nodeconnection.ConnectToAllNodes(numProcesses)
 	if attach {
 		nodeconnection.Attach()
+		reapplyBreakpoints(nodeconnection.GetRegisteredIds())
 	}
 	// logger.Verbose("DONE WITH CONNECT")
 }
@@ -506,7 +700,7 @@ func restore(checkpointDir string, pid int, numProcesses int) *os.File {
 	syscall.Wait4(pid, nil, 0, nil)
 	// logger.Info("RESTORING %s", checkpointDir)
 
-	if program=="criu"{
+	if program==cli.CRIU_BACKEND{
 		return restoreCriu(checkpointDir, pid, numProcesses);
 	}else{ //} if(program=="dmtcp"){
 		return restoreDmtcp(checkpointDir, pid, numProcesses);
@@ -516,13 +710,13 @@ func restore(checkpointDir string, pid int, numProcesses int) *os.File {
 func restoreDmtcp(checkpointDir string, pid int, numProcesses int) *os.File {
 	entries, err := os.ReadDir(checkpointDir) 
 	if err != nil {
-		logger.Error("problem renameing",err)
+		logger.Error("problem renameing: %v", err)
 	}
 	for _, e := range entries {
 		copy(checkpointDir+"/"+e.Name(), dmtcpImgDir+"/"+e.Name())
     }
 
-	cmd := exec.Command(checkpointDir+"/dmtcp_restart_script.sh", "--ckptdir", dmtcpImgDir)
+	cmd := exec.Command(checkpointDir+"/dmtcp_restart_script.sh", "--ckptdir", dmtcpImgDir, "--coord-port", dmtcpCoordinatorPort())
 
 	f, err := pty.Start(cmd)
 	if err != nil {
@@ -565,15 +759,32 @@ func restoreCriu(checkpointDir string, pid int, numProcesses int) *os.File {
 }
 
 func checkpoint(c *criu.Criu) string{
-	if program=="criu"{
+	if program==cli.CRIU_BACKEND{
 		return checkpointCRIU(numProcesses, c, pid, true)
 	}else{ // if program=="dmtcp"
 		return checkpointDmtcp()
 	}
 }
 
+// file the dmtcp coordinator writes its port into, needed when the port is selected by the coordinator
+func dmtcpPortFile() string {
+	return fmt.Sprintf("%v/coordinator-port", sessionDir)
+}
+
+func dmtcpCoordinatorPort() string {
+	if config.DmtcpPort != 0 {
+		return fmt.Sprint(config.DmtcpPort)
+	}
+
+	port, err := os.ReadFile(dmtcpPortFile())
+	if err != nil {
+		logger.Error("cannot read dmtcp coordinator port: %v", err)
+	}
+	return strings.TrimSpace(string(port))
+}
+
 func checkpointDmtcp() string{
-	cmd := exec.Command("dmtcp_command", "--checkpoint") 
+	cmd := exec.Command("dmtcp_command", "--coord-port", dmtcpCoordinatorPort(), "--checkpoint")
 	if err := cmd.Run(); err != nil {
 		logger.Error("dmtcp_command exited with: %v", err)
 	}
@@ -584,7 +795,7 @@ func checkpointDmtcp() string{
 	for !finished{
 		entries, err := os.ReadDir(dmtcpImgDir)
 		if err != nil {
-			logger.Error("problem renameing",err)
+			logger.Error("problem renameing: %v", err)
 			time.Sleep(1 * time.Second) 
 		}
 		for _, e := range entries {
@@ -595,7 +806,7 @@ func checkpointDmtcp() string{
 	}
 	entries, err := os.ReadDir(dmtcpImgDir) 
 	if err != nil {
-		logger.Error("problem renameing",err)
+		logger.Error("problem renameing: %v", err)
 	}
 	for _, e := range entries {
 		err :=  os.Rename(dmtcpImgDir+"/"+e.Name(), imgDir.Name()+"/"+e.Name())
@@ -700,6 +911,7 @@ func handleRollbackSubmission(cmd *command.Command) {
 	}
 
 	nodeconnection.ExecutePendingRollback()
+	reapplyBreakpoints(nodeconnection.GetRegisteredIds())
 }
 
 func startCheckpointRecordCollector(
@@ -708,8 +920,9 @@ func startCheckpointRecordCollector(
 	for {
 		callRecord := <-channel
 
-		logger.Debug("Node %v reported MPI call: %v", callRecord.NodeId, callRecord.OpName)
+		logger.Debug("Rank %v reported MPI call: %v", nodeconnection.RankOfNode(callRecord.NodeId), callRecord.OpName)
 
+		mpiEventCount.Add(1)
 		checkpointmanager.RecordCheckpoint(callRecord)
 		websocket.SendCheckpointUpdateMessage(checkpointmanager.GetCheckpointLog())
 	}
@@ -719,8 +932,13 @@ func quit() {
 	nodeconnection.StopAllNodes()
 	gui.Stop()
 
+	// checkpoints, labels and branches of the session are kept unless asked otherwise
+	if config.CleanupSession && sessionDir != "" {
+		os.RemoveAll(sessionDir)
+	}
+
 	logger.Info("👋 exiting")
-	os.Exit(0)
+	os.Exit(exitCode)
 }
 
 // func reverseContLoop(cmd *command.Command, secondRun bool, hitcount []int, wg *sync.WaitGroup, log checkpointmanager.CommandLog) []int {
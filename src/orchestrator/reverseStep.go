@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/mihkeltiks/rev-mpi-deb/logger"
+	nodeconnection "github.com/mihkeltiks/rev-mpi-deb/orchestrator/nodeConnection"
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
+// Goes back a source line on the ranks of the command. Reverse-step goes back to the line executed before,
+// reverse-next to the previous line of the same function, over the calls made from it.
+// The program is replayed from the latest checkpoint before it with the ranks sampling their frame and line at every statement
+// counter up to their current one, then replayed again to the counters of the previous lines
+func reverseStepLine(cmd *command.Command, overCalls bool) {
+	nodeIds := nodeconnection.TargetNodeIds(cmd)
+	counters := retrieveCounters()
+
+	// the replays pass breakpoints the user has already seen hit
+	nodeconnection.SetBreakpointHitRecording(false)
+	defer nodeconnection.SetBreakpointHitRecording(true)
+
+	samplings := make([]*command.Command, len(nodeIds))
+	for index, nodeId := range nodeIds {
+		samplings[index] = &command.Command{
+			NodeId:   nodeId,
+			Code:     command.PreviousLine,
+			Argument: command.LineSampling{Counter: counters[nodeId], OverCalls: overCalls},
+		}
+	}
+
+	previousLines := replaySampling(counters, samplings)
+
+	moved := false
+	for _, nodeId := range nodeIds {
+		if previousLines[nodeId] <= 0 {
+			logger.Info("rank %d is at the first line, it stays where it was", nodeconnection.RankOfNode(nodeId))
+			continue
+		}
+		counters[nodeId] = previousLines[nodeId]
+		moved = true
+	}
+
+	if moved {
+		replayToCounters(counters)
+	}
+
+	endReplay(counters)
+}
@@ -11,16 +11,9 @@ import (
 
 type Registrator func(any) error
 
-func InitializeServer(port int, registerComponents func(Registrator)) {
-	// register components
-	registerComponents(rpc.Register)
-
-	// register heartbeat
-	rpc.Register(new(Health))
-
-	//serve
-	rpc.HandleHTTP()
-
+// Starts listening for rpc connections on localhost.
+// Port 0 selects a free port, which can be read with ListenerPort
+func Listen(port int) net.Listener {
 	serverAddress := fmt.Sprintf("localhost:%d", port)
 
 	listener, err := net.Listen("tcp", serverAddress)
@@ -28,9 +21,26 @@ func InitializeServer(port int, registerComponents func(Registrator)) {
 		logger.Error("logger server listen error: %v", err)
 		panic(err)
 	} else {
-		logger.Verbose("rpc server listening on address: %v", serverAddress)
+		logger.Verbose("rpc server listening on address: %v", listener.Addr())
 	}
 
+	return listener
+}
+
+func ListenerPort(listener net.Listener) int {
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func Serve(listener net.Listener, registerComponents func(Registrator)) {
+	// register components
+	registerComponents(rpc.Register)
+
+	// register heartbeat
+	rpc.Register(new(Health))
+
+	//serve
+	rpc.HandleHTTP()
+
 	http.Serve(listener, nil)
 }
 
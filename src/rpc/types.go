@@ -1,8 +1,81 @@
 package rpc
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mihkeltiks/rev-mpi-deb/utils/command"
+)
+
 type MPICallRecord struct {
 	Id         string
 	OpName     string
 	Parameters map[string]string
 	NodeId     int
+	Rank       int // MPI_COMM_WORLD rank of the reporting process, -1 if unknown
+}
+
+// Sent by a node debugger when registering with the orchestrator
+type NodeRegistration struct {
+	Pid  int // process id of the node debugger
+	Port int // port of the rpc server of the node debugger
+	Rank int // MPI_COMM_WORLD rank assigned by the mpi launcher, -1 if unknown
+}
+
+// Sent by a node debugger in response to a RetrieveBreakpoints command
+type NodeBreakpoints struct {
+	NodeId      int
+	Breakpoints []command.Breakpoint
+}
+
+// Sent by a node debugger when it passes a numbered breakpoint whose condition holds
+type BreakpointHit struct {
+	NodeId       int
+	BreakpointId int
+	Ignored      bool // the hit was passed due to the ignore count of the breakpoint
+}
+
+// Sent by a node debugger when the target stops at a breakpoint, or during reverse execution at its statement counter target
+type BreakpointStop struct {
+	NodeId        int
+	BreakpointId  int  // number in the breakpoint table of the orchestrator, 0 for breakpoints without one
+	CounterTarget bool // the target stopped at its statement counter target instead of a breakpoint
+}
+
+// Sent by a node debugger when a watchpoint on a local variable is bound to the frame of the variable,
+// and when the frame returns and the watchpoint is deleted
+type WatchpointScope struct {
+	NodeId       int
+	BreakpointId int
+	Frame        uint64 // canonical frame address of the frame, 0 - the frame returned
+}
+
+// Sent by a node debugger in response to a Locate command
+type VariableLocation struct {
+	NodeId   int
+	Address  uint64
+	Frame    uint64 // canonical frame address of the frame declaring the variable, 0 for globals
+	Function string // function of the frame declaring the variable, empty for globals
+}
+
+// A frame of the call stack of a node
+type StackFrame struct {
+	Function   string
+	File       string
+	Line       int
+	Parameters []string // name=value
+}
+
+func (f StackFrame) String() string {
+	if f.File == "" {
+		return fmt.Sprintf("%v, no debug information", f.Function)
+	}
+	return fmt.Sprintf("%v (%v) at %v:%d", f.Function, strings.Join(f.Parameters, ", "), f.File, f.Line)
+}
+
+// Sent by a node debugger in response to a Backtrace command
+type NodeBacktrace struct {
+	NodeId   int
+	Frames   []StackFrame // innermost first
+	Selected int          // index of the frame variables are printed in
 }
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mihkeltiks/rev-mpi-deb/utils"
+)
+
+// A debugging session of the parallel sessions test, stopping at its own line of send-receive.c
+type parallelSession struct {
+	breakpoint int    // line the session stops at
+	phase      string // value of phase at that line
+	output     string
+	err        error
+}
+
+var (
+	orchestratorPattern = regexp.MustCompile(`orchestrator listening on \S+:(\d+), session directory (\S+)`)
+	nodePattern         = regexp.MustCompile(`rank (\d+) registered, its debugger listening on port (\d+)`)
+	websocketPattern    = regexp.MustCompile(`starting websocket server for gui on \S+:(\d+)`)
+	dmtcpPattern        = regexp.MustCompile(`dmtcp coordinator listening on port (\d+)`)
+	caughtPattern       = regexp.MustCompile(`Caught at a breakpoint: line: (\d+)`)
+	phasePattern        = regexp.MustCompile(`Value of phase: (\S+)`)
+)
+
+// Runs two sessions on the send-receive example side by side, on ephemeral ports and the same checkpoint directory.
+// Each session has to stop at its own breakpoint and print its own value, on ports and in a session directory of its own
+func TestParallelSessions(t *testing.T) {
+	root, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "bin/targets/send-receive")
+
+	for _, file := range []string{"bin/orchestrator", "bin/node-debugger", "bin/targets/send-receive"} {
+		if _, err := os.Stat(filepath.Join(root, file)); err != nil {
+			t.Skipf("%v is not built", file)
+		}
+	}
+	if _, err := exec.LookPath("mpirun"); err != nil {
+		t.Skip("mpirun not found")
+	}
+
+	backend := ""
+	if _, err := exec.LookPath("dmtcp_launch"); err == nil {
+		backend = "dmtcp"
+	} else if _, err := exec.LookPath("criu"); err == nil && os.Geteuid() == 0 {
+		backend = "criu"
+	}
+	if backend == "" {
+		t.Skip("neither dmtcp nor criu (as root) is available")
+	}
+
+	checkpointDir := t.TempDir()
+
+	sessions := []*parallelSession{
+		{breakpoint: 25, phase: "0"},
+		{breakpoint: 40, phase: "1"},
+	}
+
+	var wg sync.WaitGroup
+	for _, session := range sessions {
+		wg.Add(1)
+		go func(session *parallelSession) {
+			defer wg.Done()
+			session.run(t, root, target, backend, checkpointDir)
+		}(session)
+	}
+	wg.Wait()
+
+	ports := make([]map[string]string, len(sessions))
+	sessionDirs := make([]string, len(sessions))
+
+	for index, session := range sessions {
+		if session.err != nil {
+			t.Fatalf("session stopping at line %d failed: %v\n%v", session.breakpoint, session.err, session.output)
+		}
+
+		session.checkResults(t)
+		ports[index], sessionDirs[index] = session.ports(t, backend)
+	}
+
+	for name, port := range ports[0] {
+		for otherName, otherPort := range ports[1] {
+			if port == otherPort {
+				t.Errorf("both sessions use port %v: %v of the first, %v of the second", port, name, otherName)
+			}
+		}
+	}
+
+	if sessionDirs[0] == sessionDirs[1] {
+		t.Errorf("both sessions use the session directory %v", sessionDirs[0])
+	}
+	for _, dir := range sessionDirs {
+		if filepath.Dir(dir) != checkpointDir {
+			t.Errorf("session directory %v is not in the checkpoint directory %v", dir, checkpointDir)
+		}
+
+		checkpoints, _ := filepath.Glob(filepath.Join(dir, "cp-*"))
+		dmtcpImages, _ := filepath.Glob(filepath.Join(dir, "dmtcp", "*"))
+		if len(checkpoints) == 0 && len(dmtcpImages) == 0 {
+			t.Errorf("session directory %v holds no checkpoint", dir)
+		}
+	}
+}
+
+func (session *parallelSession) run(t *testing.T, root string, target string, backend string, checkpointDir string) {
+	script := filepath.Join(t.TempDir(), "session.txt")
+	commands := fmt.Sprintf("all b %d\nall c\nall p phase\nall c\n", session.breakpoint)
+	if session.err = os.WriteFile(script, []byte(commands), 0640); session.err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(
+		ctx,
+		"bin/orchestrator",
+		"-ephemeral-ports",
+		"-headless",
+		"-log-level", "verbose",
+		"-checkpoint-dir", checkpointDir,
+		"-backend", backend,
+		"-script", script,
+		"-np", "2",
+		"-target", target)
+	cmd.Dir = root
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	session.err = cmd.Run()
+	session.output = output.String()
+}
+
+// Checks that both ranks stopped at the breakpoint of the session, and only there, and printed the value it has there
+func (session *parallelSession) checkResults(t *testing.T) {
+	caught := caughtPattern.FindAllStringSubmatch(session.output, -1)
+	if len(caught) != 2 {
+		t.Errorf("session stopping at line %d: %d ranks caught at a breakpoint, want 2", session.breakpoint, len(caught))
+	}
+	for _, match := range caught {
+		if match[1] != fmt.Sprint(session.breakpoint) {
+			t.Errorf("session stopping at line %d: caught at line %v", session.breakpoint, match[1])
+		}
+	}
+
+	values := phasePattern.FindAllStringSubmatch(session.output, -1)
+	if len(values) != 2 {
+		t.Errorf("session stopping at line %d: %d ranks printed phase, want 2", session.breakpoint, len(values))
+	}
+	for _, match := range values {
+		if match[1] != session.phase {
+			t.Errorf("session stopping at line %d: phase is %v, want %v", session.breakpoint, match[1], session.phase)
+		}
+	}
+}
+
+// The ports the servers of the session listen on, by server, and the session directory, as logged by the orchestrator
+func (session *parallelSession) ports(t *testing.T, backend string) (ports map[string]string, sessionDir string) {
+	ports = make(map[string]string)
+
+	if match := orchestratorPattern.FindStringSubmatch(session.output); match != nil {
+		ports["orchestrator"] = match[1]
+		sessionDir = match[2]
+	} else {
+		t.Errorf("session stopping at line %d: orchestrator port not logged", session.breakpoint)
+	}
+
+	nodes := nodePattern.FindAllStringSubmatch(session.output, -1)
+	for _, match := range nodes {
+		ports["node "+match[1]] = match[2]
+	}
+	if len(nodes) < 2 {
+		t.Errorf("session stopping at line %d: %d node ports logged, want 2", session.breakpoint, len(nodes))
+	}
+
+	// the websocket server is not started in containers
+	if match := websocketPattern.FindStringSubmatch(session.output); match != nil {
+		ports["websocket"] = match[1]
+	} else if !utils.IsRunningInContainer() {
+		t.Errorf("session stopping at line %d: websocket port not logged", session.breakpoint)
+	}
+
+	if backend == "dmtcp" {
+		if match := dmtcpPattern.FindStringSubmatch(session.output); match != nil {
+			ports["dmtcp"] = match[1]
+		} else {
+			t.Errorf("session stopping at line %d: dmtcp coordinator port not logged", session.breakpoint)
+		}
+	}
+
+	return ports, strings.TrimSpace(sessionDir)
+}
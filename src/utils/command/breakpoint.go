@@ -0,0 +1,133 @@
+package command
+
+import (
+	"encoding/gob"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mihkeltiks/rev-mpi-deb/utils/expression"
+)
+
+// A breakpoint at a source line of the target, or at the entry of a function.
+// A negative line marks a breakpoint the node is currently stopped at, so its first hit is ignored
+type Breakpoint struct {
+	Line      int
+	File      string // source file of the line, empty - the file holding main
+	Function  string // when set, the breakpoint is at the entry of the function, after its prologue
+	Condition string // the node stops only when the condition holds, empty - always
+
+	Id          int  // number in the breakpoint table of the orchestrator, 0 - not numbered
+	Temporary   bool // removed after the first stop
+	IgnoreCount int  // number of hits to pass before stopping
+
+	Watch      string      // when set, a hardware watchpoint on the variable instead of a breakpoint
+	Access     WatchAccess // the accesses of the watched variable stopping the node
+	WatchFrame uint64      // canonical frame address of the frame of a watched local variable on the node, 0 - resolved in the selected frame
+}
+
+// Memory accesses a watchpoint stops at
+type WatchAccess int
+
+const (
+	WatchWrite     WatchAccess = iota // watch - the value changes
+	WatchRead                         // rwatch - the value is read
+	WatchReadWrite                    // awatch - the value is read or written
+)
+
+func init() {
+	// sent to nodes as command arguments
+	gob.Register(Breakpoint{})
+	gob.Register([]Breakpoint{})
+}
+
+var lineLocationRegexp = regexp.MustCompile(`^(?:(\S+):)?(\d+)$`)
+var functionLocationRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Parses a breakpoint as given to the break command: <location> [if <condition>].
+// The location is a line of the file holding main, file:line or a function name
+func ParseBreakpoint(spec string) (Breakpoint, error) {
+	var breakpoint Breakpoint
+
+	location, condition, hasCondition := strings.Cut(strings.TrimSpace(spec), " if ")
+	location = strings.TrimSpace(location)
+
+	if match := lineLocationRegexp.FindStringSubmatch(location); match != nil {
+		breakpoint.File = match[1]
+		breakpoint.Line, _ = strconv.Atoi(match[2])
+	} else if functionLocationRegexp.MatchString(location) {
+		breakpoint.Function = location
+	} else {
+		return breakpoint, fmt.Errorf("invalid breakpoint location %q", location)
+	}
+
+	if hasCondition {
+		breakpoint.Condition = strings.TrimSpace(condition)
+
+		if _, err := expression.Parse(breakpoint.Condition); err != nil {
+			return breakpoint, fmt.Errorf("invalid breakpoint condition: %v", err)
+		}
+	}
+
+	return breakpoint, nil
+}
+
+// Parses the argument of tbreak, a breakpoint removed after its first stop
+func ParseTemporaryBreakpoint(spec string) (Breakpoint, error) {
+	breakpoint, err := ParseBreakpoint(spec)
+	breakpoint.Temporary = true
+	return breakpoint, err
+}
+
+// Parses the argument of watch, rwatch and awatch: <variable> [if <condition>]
+func ParseWatchpoint(spec string, access WatchAccess) (Breakpoint, error) {
+	watchpoint, err := ParseBreakpoint(spec)
+	if err != nil {
+		return watchpoint, err
+	}
+	if watchpoint.Function == "" {
+		return watchpoint, fmt.Errorf("a watchpoint takes a variable name")
+	}
+
+	watchpoint.Watch, watchpoint.Function = watchpoint.Function, ""
+	watchpoint.Access = access
+
+	return watchpoint, nil
+}
+
+// The kind of the breakpoint, as listed by info breakpoints
+func (b Breakpoint) Kind() string {
+	switch {
+	case b.Watch != "" && b.Access == WatchRead:
+		return "read watchpoint"
+	case b.Watch != "" && b.Access == WatchReadWrite:
+		return "acc watchpoint"
+	case b.Watch != "":
+		return "hw watchpoint"
+	case b.Temporary:
+		return "tbreak"
+	default:
+		return "breakpoint"
+	}
+}
+
+func (b Breakpoint) Location() string {
+	switch {
+	case b.Watch != "":
+		return b.Watch
+	case b.Function != "":
+		return b.Function
+	case b.File != "":
+		return fmt.Sprintf("%v:%d", b.File, b.Line)
+	default:
+		return fmt.Sprint(b.Line)
+	}
+}
+
+func (b Breakpoint) String() string {
+	if b.Condition == "" {
+		return b.Location()
+	}
+	return fmt.Sprintf("%v if %v", b.Location(), b.Condition)
+}
@@ -8,16 +8,28 @@ import (
 
 type Command struct {
 	NodeId   int
+	NodeIds  []int // nodes a command with NodeId NodeSet is addressed to
 	Code     CommandCode
 	Argument interface{}
 	Result   *CommandResult
 }
 
+// NodeId of a command addressed to every node
+const AllNodes = -1
+
+// NodeId of a command addressed to the nodes listed in NodeIds
+const NodeSet = -2
+
 type CommandCode int
 
+// Argument of a continue the orchestrator may interrupt for an automatic checkpoint and resume afterwards.
+// Continues with other arguments run to the counter target of a reverse continue
+const SupervisedCont = -1
+
 type CommandResult struct {
-	Error  string
-	Exited bool
+	Error       string
+	Exited      bool
+	Interrupted bool // a supervised continue ended where the orchestrator stopped the target or at its counter target, to be resumed
 }
 
 const (
@@ -36,10 +48,24 @@ const (
 	RetrieveBreakpoints
 	ChangeBreakpoints
 	RemoveBreakpoints
+	RemoveBreakpoint
 	ListCheckpoints
 	GlobalRollback
 	GRestore
 	Checkpoint
+	Group
+	ListBreakpoints
+	DeleteBreakpoint
+	DisableBreakpoint
+	EnableBreakpoint
+	IgnoreBreakpoint
+	Branch
+	ListBranches
+	SwitchBranch
+	CompareBranches
+	PrintTree
+	Label
+	DeleteCheckpoint
 	// Node-specific commands - executed on designated node
 	Bpoint
 	Next
@@ -50,6 +76,20 @@ const (
 	Restore
 	Print
 	PrintInternal
+	LastChange
+	Finish
+	ReverseFinish
+	CallSite
+	Until
+	ReverseNext
+	PreviousLine
+	Backtrace
+	Frame
+	MoveFrame
+	Display
+	Undisplay
+	SetVariable
+	Locate
 )
 
 func (c Command) String() string {
@@ -58,7 +98,7 @@ func (c Command) String() string {
 		Checkpoint:        "checkpoint",
 		SingleStep:        "single-step",
 		Next:              "next",
-		ReverseSingleStep: "reverse-single-step",
+		ReverseSingleStep: "reverse-step",
 		Cont:              "continue",
 		ReverseCont:       "reverse-continue",
 		GRestore:           "restore",
@@ -74,6 +114,33 @@ func (c Command) String() string {
 		Help:              "help",
 		PrintInternal:     "print-internal",
 		ListCheckpoints:   "list-checkpoints",
+		LastChange:        "rwatch-last",
+		Finish:            "finish",
+		ReverseFinish:     "reverse-finish",
+		CallSite:          "call-site",
+		Until:             "until",
+		ReverseNext:       "reverse-next",
+		PreviousLine:      "previous-line",
+		Backtrace:         "backtrace",
+		Frame:             "frame",
+		MoveFrame:         "move-frame",
+		Display:           "display",
+		Undisplay:         "undisplay",
+		SetVariable:       "set-var",
+		Locate:            "locate",
+		Group:             "group",
+		ListBreakpoints:   "info-breakpoints",
+		DeleteBreakpoint:  "delete",
+		DisableBreakpoint: "disable",
+		EnableBreakpoint:  "enable",
+		IgnoreBreakpoint:  "ignore",
+		Branch:            "branch",
+		ListBranches:      "branches",
+		SwitchBranch:      "switch",
+		CompareBranches:   "compare",
+		PrintTree:         "tree",
+		Label:             "label",
+		DeleteCheckpoint:  "delete-checkpoint",
 	}[c.Code]
 
 	if c.Argument == nil {
@@ -83,14 +150,37 @@ func (c Command) String() string {
 	}
 }
 
+// Whether the command is relayed to nodes for execution, as opposed to being executed on the orchestrator
+func (cmd *Command) IsNodeCommand() bool {
+	return cmd.Code >= Bpoint
+}
+
 func (cmd *Command) IsForwardProgressCommand() bool {
-	return cmd.Code == SingleStep || cmd.Code == Cont || cmd.Code == Next
+	return cmd.Code == SingleStep || cmd.Code == Cont || cmd.Code == Next || cmd.Code == Finish || cmd.Code == Until
+}
+
+// Whether the command is a continue the orchestrator may interrupt for an automatic checkpoint
+func (cmd *Command) IsSupervisedCont() bool {
+	return cmd.Code == Cont && cmd.Argument == SupervisedCont
 }
 
 func (cmd *Command) IsProgressCommand() bool {
 	return cmd.IsForwardProgressCommand() || cmd.Code == Restore
 }
 
+// Whether the command is to be executed on the node with the given id
+func (cmd *Command) TargetsNode(nodeId int) bool {
+	if cmd.NodeId == NodeSet {
+		for _, id := range cmd.NodeIds {
+			if id == nodeId {
+				return true
+			}
+		}
+		return false
+	}
+	return cmd.NodeId == AllNodes || cmd.NodeId == nodeId
+}
+
 func (cmd *Command) Print() {
-	logger.Verbose("%v", cmd.NodeId, cmd.Code, cmd.Argument, cmd.Result)
+	logger.Verbose("%v %v %v %v", cmd.NodeId, cmd.Code, cmd.Argument, cmd.Result)
 }
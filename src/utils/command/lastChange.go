@@ -0,0 +1,17 @@
+package command
+
+import "encoding/gob"
+
+// Asks a node to run to a statement counter, sampling a variable at every counter on the way.
+// The variable is the object located at the stop the sampling goes back from
+type VariableSampling struct {
+	Variable string
+	Counter  int    // counter to run to
+	Address  uint64 // address of the variable
+	Frame    uint64 // canonical frame address of the frame declaring the variable, 0 for globals
+	Function string // function of the frame declaring the variable
+}
+
+func init() {
+	gob.Register(VariableSampling{})
+}
@@ -0,0 +1,13 @@
+package command
+
+import "encoding/gob"
+
+// Asks a node to run to a statement counter, sampling its frame and line at every counter on the way
+type LineSampling struct {
+	Counter   int  // counter to run to
+	OverCalls bool // whether lines of the functions called are skipped
+}
+
+func init() {
+	gob.Register(LineSampling{})
+}
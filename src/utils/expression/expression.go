@@ -0,0 +1,464 @@
+package expression
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A parsed C expression, like the condition of a breakpoint: i == 3 && rank == 0, or an expression to print: cells[i].pos.x * 2.
+// Expressions are evaluated by the node debuggers, over the memory of the target
+type Expr interface {
+	String() string
+}
+
+type Integer struct {
+	Value    int64
+	Unsigned bool // written with a u suffix
+}
+
+type Float struct {
+	Value float64
+}
+
+type Char struct {
+	Value byte
+}
+
+type Identifier struct {
+	Name string
+}
+
+type Unary struct {
+	Op      string // - + ! ~, * dereferencing and & taking the address
+	Operand Expr
+}
+
+type Binary struct {
+	Op          string
+	Left, Right Expr
+}
+
+// A cast to a type written in C, like (double) sum or (struct cell *) p
+type Cast struct {
+	TypeName string
+	Operand  Expr
+}
+
+type Index struct {
+	Array, Index Expr
+}
+
+type Member struct {
+	Operand Expr
+	Name    string
+	Arrow   bool // accessed through a pointer, as in p->next
+}
+
+// binary operators by precedence, lowest first
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+var unaryOperators = []string{"-", "+", "!", "~", "*", "&"}
+
+// other tokens made of symbols
+var punctuation = []string{"->", "(", ")", "[", "]", ".", "!", "~", "="}
+
+// words starting the name of a type in a cast
+var typeKeywords = map[string]bool{
+	"void": true, "char": true, "short": true, "int": true, "long": true, "float": true, "double": true,
+	"signed": true, "unsigned": true, "_Bool": true, "const": true, "volatile": true,
+	"struct": true, "union": true, "enum": true,
+}
+
+func Parse(input string) (Expr, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTokens(tokens, input)
+}
+
+// Parses an assignment, like a[2].v = 1.5 or $rax = 0, into the expression assigned to and the value assigned
+func ParseAssignment(input string) (target Expr, value Expr, err error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for index, token := range tokens {
+		if token != "=" {
+			continue
+		}
+
+		if target, err = parseTokens(tokens[:index], input); err != nil {
+			return nil, nil, err
+		}
+		if value, err = parseTokens(tokens[index+1:], input); err != nil {
+			return nil, nil, err
+		}
+		return target, value, nil
+	}
+
+	return nil, nil, fmt.Errorf("expected an assignment, like x = 3, in %q", input)
+}
+
+func parseTokens(tokens []string, input string) (Expr, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression in %q", input)
+	}
+
+	p := &parser{tokens: tokens}
+
+	expr, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in %q", p.tokens[p.pos], input)
+	}
+
+	return expr, nil
+}
+
+func tokenize(input string) ([]string, error) {
+	tokens := []string{}
+
+	for i := 0; i < len(input); {
+		c := rune(input[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.' && i+1 < len(input) && unicode.IsDigit(rune(input[i+1])):
+			j := i
+			for j < len(input) && (unicode.IsLetter(rune(input[j])) || unicode.IsDigit(rune(input[j])) || input[j] == '.' ||
+				// the sign of an exponent
+				(input[j] == '-' || input[j] == '+') && (input[j-1] == 'e' || input[j-1] == 'E') && !isHex(input[i:j])) {
+				j++
+			}
+			tokens = append(tokens, input[i:j])
+			i = j
+		case unicode.IsLetter(c) || c == '_' || c == '$':
+			// $ starts the names of registers
+			j := i + 1
+			for j < len(input) && (unicode.IsLetter(rune(input[j])) || unicode.IsDigit(rune(input[j])) || input[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, input[i:j])
+			i = j
+		case c == '\'':
+			j := i + 1
+			for j < len(input) && input[j] != '\'' {
+				if input[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(input) {
+				return nil, fmt.Errorf("missing ' in %q", input)
+			}
+			tokens = append(tokens, input[i:j+1])
+			i = j + 1
+		default:
+			token := ""
+			for _, candidate := range append(append([]string{}, punctuation...), operatorsByLength()...) {
+				if strings.HasPrefix(input[i:], candidate) && len(candidate) > len(token) {
+					token = candidate
+				}
+			}
+			if token == "" {
+				return nil, fmt.Errorf("unexpected character %q in %q", c, input)
+			}
+			tokens = append(tokens, token)
+			i += len(token)
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+
+	return tokens, nil
+}
+
+func isHex(number string) bool {
+	return strings.HasPrefix(number, "0x") || strings.HasPrefix(number, "0X")
+}
+
+func operatorsByLength() []string {
+	operators := append([]string{}, unaryOperators...)
+	for _, level := range precedence {
+		operators = append(operators, level...)
+	}
+	return operators
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	return p.peekAt(0)
+}
+
+func (p *parser) peekAt(offset int) string {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *parser) parseBinary(level int) (Expr, error) {
+	if level == len(precedence) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.peek()
+
+		matches := false
+		for _, candidate := range precedence[level] {
+			matches = matches || op == candidate
+		}
+		if !matches {
+			return left, nil
+		}
+
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		left = Binary{op, left, right}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	token := p.peek()
+
+	for _, op := range unaryOperators {
+		if token == op {
+			p.next()
+			operand, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return Unary{op, operand}, nil
+		}
+	}
+
+	if token == "(" {
+		if typeName, length := p.castType(); length > 0 {
+			p.pos += length
+			operand, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return Cast{typeName, operand}, nil
+		}
+	}
+
+	return p.parsePostfix()
+}
+
+// Recognizes the parenthesized name of a type at the current token, as a cast.
+// Names of typedefs cannot be told apart from variables, they are taken as types when a cast is the only way to read them.
+// Returns the name and the number of tokens including the parentheses, 0 if there is no cast
+func (p *parser) castType() (typeName string, length int) {
+	words := []string{}
+
+	for offset := 1; ; offset++ {
+		token := p.peekAt(offset)
+
+		switch {
+		case token == ")":
+			if len(words) == 0 {
+				return "", 0
+			}
+			last := words[len(words)-1]
+			following := p.peekAt(offset + 1)
+
+			isCast := typeKeywords[words[0]] || strings.HasSuffix(last, "*") ||
+				len(words) == 1 && following != "" && (isIdentifier(following) || unicode.IsDigit(rune(following[0])) || following == "(" || following[0] == '\'')
+
+			// registers are not types
+			isCast = isCast && words[0][0] != '$'
+
+			if !isCast {
+				return "", 0
+			}
+			return strings.Join(words, " "), offset + 1
+
+		case token == "*":
+			words = append(words, token)
+		case token != "" && isIdentifier(token):
+			words = append(words, token)
+		default:
+			return "", 0
+		}
+	}
+}
+
+func isIdentifier(token string) bool {
+	return unicode.IsLetter(rune(token[0])) || token[0] == '_' || token[0] == '$'
+}
+
+func (p *parser) parsePostfix() (Expr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch p.peek() {
+		case "[":
+			p.next()
+			index, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			if p.next() != "]" {
+				return nil, fmt.Errorf("missing ]")
+			}
+			expr = Index{expr, index}
+
+		case ".", "->":
+			arrow := p.next() == "->"
+			name := p.next()
+			if name == "" || !isIdentifier(name) {
+				return nil, fmt.Errorf("expected a member name after %v", expr)
+			}
+			expr = Member{expr, name, arrow}
+
+		default:
+			return expr, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	switch token := p.next(); {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+
+	case token == "(":
+		expr, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return expr, nil
+
+	case unicode.IsDigit(rune(token[0])) || token[0] == '.':
+		return parseNumber(token)
+
+	case token[0] == '\'':
+		return parseChar(token)
+
+	case isIdentifier(token):
+		return Identifier{token}, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+}
+
+func parseNumber(token string) (Expr, error) {
+	isFloat := !isHex(token) && strings.ContainsAny(token, ".eE")
+
+	if isFloat {
+		value, err := strconv.ParseFloat(strings.TrimRight(token, "fFlL"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", token)
+		}
+		return Float{value}, nil
+	}
+
+	digits := strings.TrimRight(token, "uUlL")
+	unsigned := strings.ContainsAny(token[len(digits):], "uU")
+
+	value, err := strconv.ParseUint(digits, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", token)
+	}
+	return Integer{int64(value), unsigned}, nil
+}
+
+func parseChar(token string) (Expr, error) {
+	value, _, tail, err := strconv.UnquoteChar(token[1:len(token)-1], '\'')
+	if err != nil || tail != "" || value > 0xff {
+		return nil, fmt.Errorf("invalid character %v", token)
+	}
+	return Char{byte(value)}, nil
+}
+
+func (i Integer) String() string {
+	if i.Unsigned {
+		return strconv.FormatUint(uint64(i.Value), 10) + "u"
+	}
+	return strconv.FormatInt(i.Value, 10)
+}
+
+func (f Float) String() string {
+	return strconv.FormatFloat(f.Value, 'g', -1, 64)
+}
+
+func (c Char) String() string {
+	return strconv.QuoteRuneToASCII(rune(c.Value))
+}
+
+func (i Identifier) String() string {
+	return i.Name
+}
+
+func (u Unary) String() string {
+	return u.Op + u.Operand.String()
+}
+
+func (b Binary) String() string {
+	return strings.Join([]string{"(" + b.Left.String(), b.Op, b.Right.String() + ")"}, " ")
+}
+
+func (c Cast) String() string {
+	return fmt.Sprintf("(%v) %v", c.TypeName, c.Operand)
+}
+
+func (i Index) String() string {
+	return fmt.Sprintf("%v[%v]", i.Array, i.Index)
+}
+
+func (m Member) String() string {
+	if m.Arrow {
+		return fmt.Sprintf("%v->%v", m.Operand, m.Name)
+	}
+	return fmt.Sprintf("%v.%v", m.Operand, m.Name)
+}
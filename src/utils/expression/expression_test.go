@@ -0,0 +1,134 @@
+package expression
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Expr
+	}{
+		// precedence
+		{"product before sum", "1 + 2 * 3", Binary{"+", Integer{1, false}, Binary{"*", Integer{2, false}, Integer{3, false}}}},
+		{"left associative", "a - b - c", Binary{"-", Binary{"-", Identifier{"a"}, Identifier{"b"}}, Identifier{"c"}}},
+		{"parentheses", "(1 + 2) * 3", Binary{"*", Binary{"+", Integer{1, false}, Integer{2, false}}, Integer{3, false}}},
+		{"and before or", "a || b && c", Binary{"||", Identifier{"a"}, Binary{"&&", Identifier{"b"}, Identifier{"c"}}}},
+		{"comparison before equality", "a == b < c", Binary{"==", Identifier{"a"}, Binary{"<", Identifier{"b"}, Identifier{"c"}}}},
+		{"equality before bitwise and", "a & b == c", Binary{"&", Identifier{"a"}, Binary{"==", Identifier{"b"}, Identifier{"c"}}}},
+		{"sum before shift", "a << 1 + 2", Binary{"<<", Identifier{"a"}, Binary{"+", Integer{1, false}, Integer{2, false}}}},
+		{"unary before binary", "-a * b", Binary{"*", Unary{"-", Identifier{"a"}}, Identifier{"b"}}},
+		{"postfix before unary", "*p.x", Unary{"*", Member{Identifier{"p"}, "x", false}}},
+		{"parenthesized dereference", "(*p).x", Member{Unary{"*", Identifier{"p"}}, "x", false}},
+
+		// casts and parenthesized identifiers
+		{"cast to keyword type", "(int) x", Cast{"int", Identifier{"x"}}},
+		{"cast before division", "(double) a / b", Binary{"/", Cast{"double", Identifier{"a"}}, Identifier{"b"}}},
+		{"cast to struct pointer", "(struct cell *) p", Cast{"struct cell *", Identifier{"p"}}},
+		{"cast to typedef pointer", "(real *) p", Cast{"real *", Identifier{"p"}}},
+		{"cast to typedef", "(real) y", Cast{"real", Identifier{"y"}}},
+		{"cast of negated number", "(unsigned long) -1", Cast{"unsigned long", Unary{"-", Integer{1, false}}}},
+		{"parenthesized identifier plus", "(x) + 1", Binary{"+", Identifier{"x"}, Integer{1, false}}},
+		{"parenthesized identifier minus", "(x) - 1", Binary{"-", Identifier{"x"}, Integer{1, false}}},
+		{"parenthesized identifier times", "(count) * 2", Binary{"*", Identifier{"count"}, Integer{2, false}}},
+		{"parenthesized identifier indexed", "(a)[2]", Index{Identifier{"a"}, Integer{2, false}}},
+		{"parenthesized register", "($rax) + 1", Binary{"+", Identifier{"$rax"}, Integer{1, false}}},
+
+		// members
+		{"arrow chain", "p->next->value", Member{Member{Identifier{"p"}, "next", true}, "value", true}},
+		{"dot chain", "cells[i].pos.x", Member{Member{Index{Identifier{"cells"}, Identifier{"i"}}, "pos", false}, "x", false}},
+		{"arrow after dot", "s.head->value", Member{Member{Identifier{"s"}, "head", false}, "value", true}},
+
+		// numbers and exponent signs
+		{"negative exponent", "1e-3", Float{0.001}},
+		{"positive exponent", "2.5E+2", Float{250}},
+		{"exponent then minus", "1e3-1", Binary{"-", Float{1000}, Integer{1, false}}},
+		{"hex digit e is not an exponent", "0x1e-1", Binary{"-", Integer{0x1e, false}, Integer{1, false}}},
+		{"identifier minus", "e-1", Binary{"-", Identifier{"e"}, Integer{1, false}}},
+		{"leading dot", ".5", Float{0.5}},
+		{"unsigned suffix", "10u", Integer{10, true}},
+		{"character", "'a'", Char{'a'}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(test.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", test.input, err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{"", "a +", "(int)", "(a + b", "a[1", "p->", "x = 1", "a $ b", "'a"} {
+		if expr, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", input, expr)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"a==b", []string{"a", "==", "b"}},
+		{"a=b", []string{"a", "=", "b"}},
+		{"a = = b", []string{"a", "=", "=", "b"}},
+		{"a!=b", []string{"a", "!=", "b"}},
+		{"!a", []string{"!", "a"}},
+		{"a<=b", []string{"a", "<=", "b"}},
+		{"a<<=b", []string{"a", "<<", "=", "b"}},
+		{"p->x", []string{"p", "->", "x"}},
+		{"a--b", []string{"a", "-", "-", "b"}},
+		{"a&&&b", []string{"a", "&&", "&", "b"}},
+	}
+
+	for _, test := range tests {
+		got, err := tokenize(test.input)
+		if err != nil {
+			t.Errorf("tokenize(%q) returned error: %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseAssignment(t *testing.T) {
+	tests := []struct {
+		input      string
+		wantTarget Expr
+		wantValue  Expr
+	}{
+		{"x = 3", Identifier{"x"}, Integer{3, false}},
+		{"a[2].v = 1.5", Member{Index{Identifier{"a"}, Integer{2, false}}, "v", false}, Float{1.5}},
+		{"$rax = 0", Identifier{"$rax"}, Integer{0, false}},
+		{"x = y == 3", Identifier{"x"}, Binary{"==", Identifier{"y"}, Integer{3, false}}},
+		{"p->n = -1", Member{Identifier{"p"}, "n", true}, Unary{"-", Integer{1, false}}},
+	}
+
+	for _, test := range tests {
+		target, value, err := ParseAssignment(test.input)
+		if err != nil {
+			t.Errorf("ParseAssignment(%q) returned error: %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(target, test.wantTarget) || !reflect.DeepEqual(value, test.wantValue) {
+			t.Errorf("ParseAssignment(%q) = %#v, %#v, want %#v, %#v", test.input, target, value, test.wantTarget, test.wantValue)
+		}
+	}
+
+	for _, input := range []string{"x == 3", "x <= 3", "x =", "= 3"} {
+		if _, _, err := ParseAssignment(input); err == nil {
+			t.Errorf("ParseAssignment(%q) returned no error", input)
+		}
+	}
+}
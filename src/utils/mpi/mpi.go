@@ -1,5 +1,10 @@
 package mpi
 
+import (
+	"os"
+	"strconv"
+)
+
 type MPICallRecord struct {
 	Id         string
 	OpName     string
@@ -31,3 +36,16 @@ var RESTORABLE_OPERATIONS = map[string]bool{
 	MPI_OPS[OP_SEND]: true,
 	MPI_OPS[OP_RECV]: true,
 }
+
+// environment variables in which mpi launchers (MPICH/Hydra, Open MPI, PMIx) expose the MPI_COMM_WORLD rank
+var rankEnvVariables = []string{"PMI_RANK", "OMPI_COMM_WORLD_RANK", "PMIX_RANK"}
+
+// Returns the rank of the current process as assigned by the mpi launcher
+func RankFromEnv() (rank int, ok bool) {
+	for _, name := range rankEnvVariables {
+		if value, err := strconv.Atoi(os.Getenv(name)); err == nil {
+			return value, true
+		}
+	}
+	return -1, false
+}